@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+
+	"snippetbox.octaviorassi.net/internal/models"
+	"snippetbox.octaviorassi.net/internal/validator"
+)
+
+// The longest annotation that can be posted, in characters
+const MaxAnnotationLength = 2000
+
+type annotationForm struct {
+	LineStart	int		`form:"line_start"`
+	// The last line of the range, or 0 to annotate a single line
+	LineEnd		int		`form:"line_end"`
+	Body		string	`form:"body"`
+	validator.Validator	`form:"-"`
+}
+
+/*	codeBlock is a run of highlighted lines ending with the annotations shown under
+	its last line	*/
+type codeBlock struct {
+	HTML			template.HTML
+	Annotations		[]models.Annotation
+}
+
+/*	annotationView is an annotation as shown on a snippet's page, along with what the
+	template needs to offer deleting it	*/
+type annotationView struct {
+	models.Annotation
+	CanDelete		bool
+	CSRFToken		string
+}
+
+/*	newAnnotationView prepares an annotation to be shown on the page described by
+	`data`. Authors can delete their own annotations, and owners any on their snippet	*/
+func newAnnotationView(a models.Annotation, data templateData) annotationView {
+	userID := data.AuthenticatedUserID
+
+	return annotationView{
+		Annotation:	a,
+		CanDelete:	userID != 0 && (a.UserID == userID || data.Snippet.UserID == userID),
+		CSRFToken:	data.CSRFToken,
+	}
+}
+
+/*	lineCount returns the number of lines read from `r`, counted in the same way as
+	they are numbered when highlighted. The content is counted as it is read, since it
+	may come from the content store	*/
+func lineCount(r io.Reader) (int, error) {
+	buf := make([]byte, 32 << 10)
+	newlines := 0
+	last := byte(0)
+
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			newlines += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// A trailing newline does not start another line
+	if last == '\n' {
+		newlines--
+	}
+
+	return newlines + 1, nil
+}
+
+/*	annotateLines splits highlighted content into blocks, so that every annotation is
+	shown under the last line it refers to. Outdated annotations, and those that fall
+	past the end of the content, have no line to go under and are returned apart	*/
+func annotateLines(rendered renderedContent, annotations []models.Annotation) ([]codeBlock, []models.Annotation) {
+	if rendered.Markdown {
+		return nil, annotations
+	}
+
+	// The highlighter renders each line as an element of its own, one per line of output
+	lines := strings.Split(string(rendered.HTML), "\n")
+
+	byLine := make(map[int][]models.Annotation)
+	var rest []models.Annotation
+
+	for _, a := range annotations {
+		if a.Outdated || a.LineEnd > len(lines) {
+			rest = append(rest, a)
+			continue
+		}
+		byLine[a.LineEnd] = append(byLine[a.LineEnd], a)
+	}
+
+	var blocks []codeBlock
+
+	first := 0
+	for i := range lines {
+		if byLine[i+1] == nil && i+1 < len(lines) {
+			continue
+		}
+
+		blocks = append(blocks, codeBlock{
+			HTML:			template.HTML(strings.Join(lines[first:i+1], "\n")),
+			Annotations:	byLine[i+1],
+		})
+		first = i + 1
+	}
+
+	return blocks, rest
+}
+
+func (app *application) snippetAnnotatePost(w http.ResponseWriter, r *http.Request) {
+	publicID, ok := pathPublicID(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	snippet, ok := app.unlockedSnippet(w, r, publicID)
+	if !ok {
+		return
+	}
+
+	var form annotationForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if form.LineEnd == 0 {
+		form.LineEnd = form.LineStart
+	}
+
+	body, err := app.snippets.OpenContent(snippet.Content, snippet.ContentKey)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	lines, err := lineCount(body)
+	body.Close()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	form.CheckField(validator.InRange(form.LineStart, 1, lines), "lines",
+					fmt.Sprintf("The snippet only has lines 1 to %d", lines))
+	form.CheckField(validator.InRange(form.LineEnd, form.LineStart, lines), "lines",
+					"The last line must come after the first one, within the snippet")
+	form.CheckField(validator.NotBlank(form.Body), "body",
+					"This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Body, MaxAnnotationLength), "body",
+					fmt.Sprintf("This field cannot be more than %d characters long", MaxAnnotationLength))
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "annotate.tmpl.html", data)
+		return
+	}
+
+	id, err := app.annotations.Insert(snippet.ID, app.authenticatedUserID(r), form.LineStart, form.LineEnd, form.Body)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s#annotation-%d", publicID, id), http.StatusSeeOther)
+}
+
+func (app *application) annotationDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	annotation, err := app.annotations.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	snippet, err := app.snippets.Get(annotation.SnippetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if !app.canRead(r, snippet) {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Authors can delete their own annotations, and owners any on their snippet
+	userID := app.authenticatedUserID(r)
+	if annotation.UserID != userID && snippet.UserID != userID {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err = app.annotations.Delete(annotation.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Annotation deleted.")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.PublicID), http.StatusSeeOther)
+}
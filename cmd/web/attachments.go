@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox.octaviorassi.net/internal/blob"
+	"snippetbox.octaviorassi.net/internal/models"
+	"snippetbox.octaviorassi.net/internal/validator"
+)
+
+// The most files that can be attached to a snippet, and how large each of them can be
+const (
+	MaxAttachments		= 5
+	MaxAttachmentSize	= 5 << 20
+)
+
+// The largest create form accepted: the attachments and the files, plus room for the
+// other fields
+const MaxUploadSize = MaxAttachments * MaxAttachmentSize + MaxFiles * MaxContentSize + (1 << 20)
+
+// How much of an upload is kept in memory before the rest goes to temporary files
+const MaxUploadMemory = 8 << 20
+
+// How long a request with an upload has to be sent and answered
+const UploadTimeout = 2 * time.Minute
+
+/*	attachmentTypes lists the media types that can be attached, as detected from the
+	data itself rather than trusting what the browser claims. Images are shown on the
+	snippet's page, anything else is only ever downloaded	*/
+var attachmentTypes = map[string]bool{
+	"image/png":					true,
+	"image/jpeg":					true,
+	"image/gif":					true,
+	"image/webp":					true,
+	"application/pdf":				true,
+	"application/zip":				true,
+	"application/x-gzip":			true,
+	"text/plain; charset=utf-8":	true,
+}
+
+/*	upload is an attached file that passed validation, waiting to be stored	*/
+type upload struct {
+	header		*multipart.FileHeader
+	contentType	string
+}
+
+/*	isImage reports whether an attachment is an image that can be shown inline	*/
+func isImage(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/")
+}
+
+/*	checkAttachments validates the files attached to a form, adding any problem to `v`
+	under the "attachments" key, and returns those that can be stored	*/
+func checkAttachments(v *validator.Validator, headers []*multipart.FileHeader) ([]upload, error) {
+	v.CheckField(validator.MaxCount(headers, MaxAttachments), "attachments",
+				 fmt.Sprintf("You cannot attach more than %d files", MaxAttachments))
+
+	var uploads []upload
+
+	for _, h := range headers {
+		if h.Size > MaxAttachmentSize {
+			v.AddFieldError("attachments", fmt.Sprintf("%s is larger than %s", h.Filename, humanSize(MaxAttachmentSize)))
+			continue
+		}
+
+		contentType, err := detectType(h)
+		if err != nil {
+			return nil, err
+		}
+
+		if !attachmentTypes[contentType] {
+			v.AddFieldError("attachments", fmt.Sprintf("%s is not an image, PDF, text file or archive", h.Filename))
+			continue
+		}
+
+		uploads = append(uploads, upload{header: h, contentType: contentType})
+	}
+
+	return uploads, nil
+}
+
+/*	detectType sniffs the media type of an uploaded file from its first bytes	*/
+func detectType(h *multipart.FileHeader) (string, error) {
+	f, err := h.Open()
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	buf := make([]byte, 512)
+
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return http.DetectContentType(buf[:n]), nil
+}
+
+/*	attachmentName keeps the base name of an uploaded file, which browsers may send
+	along with its path	*/
+func attachmentName(filename string) string {
+	name := filepath.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if name == "." || name == "/" {
+		return "attachment"
+	}
+	if len(name) > 100 {
+		name = name[len(name)-100:]
+	}
+	return name
+}
+
+/*	putAttachments saves the uploads to the blob store, returning the attachments to
+	record along with the snippet. If saving any of them fails, those already saved
+	are removed again	*/
+func (app *application) putAttachments(uploads []upload) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+
+	for _, u := range uploads {
+		a, err := app.putAttachment(u)
+		if err != nil {
+			app.deleteAttachments(attachments)
+			return nil, err
+		}
+
+		attachments = append(attachments, a)
+	}
+
+	return attachments, nil
+}
+
+/*	putAttachment saves a single upload to the blob store under a new key	*/
+func (app *application) putAttachment(u upload) (models.Attachment, error) {
+	key, err := blob.NewKey()
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	f, err := u.header.Open()
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	defer f.Close()
+
+	err = app.blobs.Put(key, f)
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	return models.Attachment{
+		Name:		 attachmentName(u.header.Filename),
+		ContentType: u.contentType,
+		Size:		 u.header.Size,
+		BlobKey:	 key,
+	}, nil
+}
+
+/*	deleteAttachments removes the data of attachments that were never recorded, so that
+	nothing is left behind in the blob store. Failures are only logged, since the
+	request has already failed	*/
+func (app *application) deleteAttachments(attachments []models.Attachment) {
+	for _, a := range attachments {
+		err := app.blobs.Delete(a.BlobKey)
+		if err != nil {
+			app.logger.Error(err.Error(), slog.Any("blob", a.BlobKey))
+		}
+	}
+}
+
+/*	snippetAttachment serves an attachment of the snippet reachable by the request's
+	id wildcard, under the same rules as the raw endpoints	*/
+func (app *application) snippetAttachment(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.rawSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := pathID(r, "attachment")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	attachment, err := app.attachments.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if attachment.SnippetID != snippet.ID {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := app.blobs.Get(attachment.BlobKey)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	defer data.Close()
+
+	// Only images are shown in the browser. Anything else is downloaded, and even if a
+	// browser opened it, it could not run scripts or load anything
+	disposition := "attachment"
+	if isImage(attachment.ContentType) {
+		disposition = "inline"
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Name}))
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("Cache-Control", "private")
+
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, data)
+}
+
+/*	purgeOrphanedAttachments removes up to `limit` attachments whose snippet is gone,
+	deleting their data from the blob store before their records	*/
+func (app *application) purgeOrphanedAttachments(limit int) (int64, error) {
+	orphans, err := app.attachments.Orphans(limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+
+	for _, a := range orphans {
+		err = app.blobs.Delete(a.BlobKey)
+		if err != nil {
+			return n, err
+		}
+
+		err = app.attachments.Delete(a.ID)
+		if err != nil {
+			return n, err
+		}
+
+		n++
+	}
+
+	return n, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"snippetbox.octaviorassi.net/internal/models"
+	"snippetbox.octaviorassi.net/internal/validator"
+)
+
+// The longest comment that can be posted, in characters
+const MaxCommentLength = 2000
+
+type commentForm struct {
+	Body		string	`form:"body"`
+	// The id of the comment being replied to, if any
+	ParentID	int		`form:"parent_id"`
+	validator.Validator	`form:"-"`
+}
+
+/*	check validates the form's body	*/
+func (form *commentForm) check() {
+	form.CheckField(validator.NotBlank(form.Body), "body",
+					"This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Body, MaxCommentLength), "body",
+					fmt.Sprintf("This field cannot be more than %d characters long", MaxCommentLength))
+}
+
+/*	commentSnippet fetches the comment identified by the request's id wildcard along
+	with the snippet it was posted on, which must still be readable by the user. If
+	anything fails, the error response is written and the last return value is false	*/
+func (app *application) commentSnippet(w http.ResponseWriter, r *http.Request) (models.Comment, models.Snippet, bool) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return models.Comment{}, models.Snippet{}, false
+	}
+
+	comment, err := app.comments.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Comment{}, models.Snippet{}, false
+	}
+
+	snippet, err := app.snippets.Get(comment.SnippetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Comment{}, models.Snippet{}, false
+	}
+
+	if !app.canRead(r, snippet) {
+		http.NotFound(w, r)
+		return models.Comment{}, models.Snippet{}, false
+	}
+
+	return comment, snippet, true
+}
+
+func (app *application) snippetCommentPost(w http.ResponseWriter, r *http.Request) {
+	publicID, ok := pathPublicID(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	snippet, ok := app.unlockedSnippet(w, r, publicID)
+	if !ok {
+		return
+	}
+
+	var form commentForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.check()
+
+	// Replies must stay on the same snippet as the comment they reply to
+	if form.ParentID != 0 {
+		parent, err := app.comments.Get(form.ParentID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if err != nil || parent.SnippetID != snippet.ID {
+			form.AddNonFieldError("The comment you are replying to no longer exists")
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "comment.tmpl.html", data)
+		return
+	}
+
+	id, err := app.comments.Insert(snippet.ID, app.authenticatedUserID(r), form.ParentID, form.Body)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s#comment-%d", publicID, id), http.StatusSeeOther)
+}
+
+func (app *application) commentEdit(w http.ResponseWriter, r *http.Request) {
+	comment, snippet, ok := app.commentSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if comment.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Comment = comment
+	data.Form = commentForm{Body: comment.Body}
+
+	app.render(w, r, http.StatusOK, "comment.tmpl.html", data)
+}
+
+func (app *application) commentEditPost(w http.ResponseWriter, r *http.Request) {
+	comment, snippet, ok := app.commentSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// Only the author can edit a comment
+	if comment.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	var form commentForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.check()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Comment = comment
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "comment.tmpl.html", data)
+		return
+	}
+
+	err = app.comments.Update(comment.ID, comment.UserID, form.Body)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s#comment-%d", snippet.PublicID, comment.ID), http.StatusSeeOther)
+}
+
+func (app *application) commentDeletePost(w http.ResponseWriter, r *http.Request) {
+	comment, snippet, ok := app.commentSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// Authors can delete their own comments, and owners any comment on their snippet
+	userID := app.authenticatedUserID(r)
+	if comment.UserID != userID && snippet.UserID != userID {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err := app.comments.Delete(comment.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Comment deleted.")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s#comments", snippet.PublicID), http.StatusSeeOther)
+}
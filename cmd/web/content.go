@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"io"
+
+	"snippetbox.octaviorassi.net/internal/models"
+)
+
+// The most of a body kept in the content store that is shown on the snippet's page.
+// The rest can only be read through the raw and download endpoints
+const MaxShownContent = 256 << 10
+
+/*	shownContent returns what the snippet's page shows of its main file. Bodies kept in
+	the database are shown whole, while only the start of those in the content store
+	is read, cut at the end of a line. The second return value is true if the body was
+	cut short	*/
+func (app *application) shownContent(snippet models.Snippet) (string, bool, error) {
+	return app.shownFile(models.File{Content: snippet.Content, ContentKey: snippet.ContentKey})
+}
+
+/*	shownFile returns what the snippet's page shows of one of its files, like
+	shownContent	*/
+func (app *application) shownFile(f models.File) (string, bool, error) {
+	if f.ContentKey == "" {
+		return f.Content, false, nil
+	}
+
+	body, err := app.snippets.OpenContent(f.Content, f.ContentKey)
+	if err != nil {
+		return "", false, err
+	}
+
+	defer body.Close()
+
+	// Read a byte past the limit to tell whether there is more
+	b, err := io.ReadAll(io.LimitReader(body, MaxShownContent + 1))
+	if err != nil {
+		return "", false, err
+	}
+
+	if len(b) <= MaxShownContent {
+		return string(b), false, nil
+	}
+
+	b = b[:MaxShownContent]
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+		b = b[:i+1]
+	}
+
+	return string(b), true, nil
+}
+
+/*	renderMain renders the main file of a snippet for its page, as much of it as
+	shownContent allows. Snippets with limited views are never cached	*/
+func (app *application) renderMain(snippet models.Snippet) (renderedContent, error) {
+	content, truncated, err := app.shownContent(snippet)
+	if err != nil {
+		return renderedContent{}, err
+	}
+
+	var rendered renderedContent
+	if snippet.ViewsLeft > 0 {
+		rendered, err = renderUncached(content, snippet.Language)
+	} else {
+		rendered, err = app.renderSnippet(snippet.ID, snippet.Version, 0, content, snippet.Language)
+	}
+	if err != nil {
+		return renderedContent{}, err
+	}
+
+	rendered.Truncated = truncated
+
+	return rendered, nil
+}
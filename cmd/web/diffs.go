@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"snippetbox.octaviorassi.net/internal/diff"
+	"snippetbox.octaviorassi.net/internal/models"
+)
+
+/*	diffSide is one of the two texts being compared. Name is used both as a label on
+	the page and as the file name in the unified diff	*/
+type diffSide struct {
+	Name	string
+	Content	string
+	// Whether the snippet it comes from can be indexed by search engines
+	Public	bool
+}
+
+/*	snippetDiffSides loads the snippets given by the `a` and `b` query parameters. If
+	anything fails, the error response is written and the last return value is false	*/
+func (app *application) snippetDiffSides(w http.ResponseWriter, r *http.Request) (diffSide, diffSide, bool) {
+	a, okA := queryPublicID(r, "a")
+	b, okB := queryPublicID(r, "b")
+	if !okA || !okB {
+		app.clientError(w, http.StatusBadRequest)
+		return diffSide{}, diffSide{}, false
+	}
+
+	var sides [2]diffSide
+
+	for i, publicID := range []string{a, b} {
+		snippet, ok := app.unlockedSnippet(w, r, publicID)
+		if !ok {
+			return diffSide{}, diffSide{}, false
+		}
+
+		err := app.snippets.LoadContent(&snippet)
+		if err != nil {
+			app.serverError(w, r, err)
+			return diffSide{}, diffSide{}, false
+		}
+
+		sides[i] = diffSide{
+			Name:	 fmt.Sprintf("snippet-%s", snippet.PublicID),
+			Content: snippet.Content,
+			Public:	 snippet.Visibility == models.VisibilityPublic,
+		}
+	}
+
+	return sides[0], sides[1], true
+}
+
+/*	revisionDiffSides loads two versions of the snippet identified by the request's id
+	wildcard, given by the `from` and `to` query parameters. When only one of them is
+	present the other one defaults to the adjacent version, and when neither is, the
+	current version is compared against the previous one	*/
+func (app *application) revisionDiffSides(w http.ResponseWriter, r *http.Request) (diffSide, diffSide, bool) {
+	publicID, ok := pathPublicID(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return diffSide{}, diffSide{}, false
+	}
+
+	snippet, ok := app.unlockedSnippet(w, r, publicID)
+	if !ok {
+		return diffSide{}, diffSide{}, false
+	}
+
+	from, hasFrom := queryID(r, "from")
+	to, hasTo := queryID(r, "to")
+
+	switch {
+	case hasFrom && !hasTo:
+		to = from + 1
+	case !hasFrom && hasTo:
+		from = to - 1
+	case !hasFrom && !hasTo:
+		to = snippet.Version
+		from = to - 1
+	}
+
+	if from < 1 || to > snippet.Version || from > snippet.Version {
+		http.NotFound(w, r)
+		return diffSide{}, diffSide{}, false
+	}
+
+	var sides [2]diffSide
+
+	for i, version := range []int{from, to} {
+		content, key := snippet.Content, snippet.ContentKey
+
+		// The current version is not stored as a revision
+		if version != snippet.Version {
+			revision, err := app.snippets.Revision(snippet.ID, version)
+			if err != nil {
+				if errors.Is(err, models.ErrNoRecord) {
+					http.NotFound(w, r)
+				} else {
+					app.serverError(w, r, err)
+				}
+				return diffSide{}, diffSide{}, false
+			}
+
+			content, key = revision.Content, revision.ContentKey
+		}
+
+		content, err := app.snippets.ReadContent(content, key)
+		if err != nil {
+			app.serverError(w, r, err)
+			return diffSide{}, diffSide{}, false
+		}
+
+		sides[i] = diffSide{
+			Name:	 fmt.Sprintf("snippet-%s@v%d", publicID, version),
+			Content: content,
+			Public:	 snippet.Visibility == models.VisibilityPublic,
+		}
+	}
+
+	return sides[0], sides[1], true
+}
+
+/*	renderDiff computes the diff between both sides and renders it as a page, linking
+	to the raw version of the same diff	*/
+func (app *application) renderDiff(w http.ResponseWriter, r *http.Request, a, b diffSide, rawPath string) {
+	script := diff.Lines(a.Content, b.Content)
+
+	if !a.Public || !b.Public {
+		w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+	}
+
+	data := app.newTemplateData(r)
+	data.NoIndex = !a.Public || !b.Public
+	data.Diff = diffData{
+		OldName: a.Name,
+		NewName: b.Name,
+		Hunks:   diff.Hunks(script, diff.DefaultContext),
+		RawURL:  (&url.URL{Path: rawPath, RawQuery: r.URL.RawQuery}).String(),
+	}
+
+	app.render(w, r, http.StatusOK, "diff.tmpl.html", data)
+}
+
+/*	writeRawDiff computes the diff between both sides and writes it as a downloadable
+	unified diff	*/
+func (app *application) writeRawDiff(w http.ResponseWriter, r *http.Request, a, b diffSide) {
+	script := diff.Lines(a.Content, b.Content)
+	unified := diff.Unified(a.Name, b.Name, diff.Hunks(script, diff.DefaultContext))
+
+	filename := fmt.Sprintf("%s..%s.diff", a.Name, b.Name)
+
+	if !a.Public || !b.Public {
+		w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+	}
+
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(unified))
+}
+
+func (app *application) snippetDiff(w http.ResponseWriter, r *http.Request) {
+	a, b, ok := app.snippetDiffSides(w, r)
+	if !ok {
+		return
+	}
+
+	app.renderDiff(w, r, a, b, "/snippet/diff/raw")
+}
+
+func (app *application) snippetDiffRaw(w http.ResponseWriter, r *http.Request) {
+	a, b, ok := app.snippetDiffSides(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeRawDiff(w, r, a, b)
+}
+
+func (app *application) revisionDiff(w http.ResponseWriter, r *http.Request) {
+	a, b, ok := app.revisionDiffSides(w, r)
+	if !ok {
+		return
+	}
+
+	app.renderDiff(w, r, a, b, fmt.Sprintf("/snippet/view/%s/diff/raw", r.PathValue("id")))
+}
+
+func (app *application) revisionDiffRaw(w http.ResponseWriter, r *http.Request) {
+	a, b, ok := app.revisionDiffSides(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeRawDiff(w, r, a, b)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"time"
+
+	"snippetbox.octaviorassi.net/internal/validator"
+)
+
+/*	expiryPreset is one of the expiry durations offered when creating a snippet or
+	extending its expiry. A zero Duration means the snippet never expires	*/
+type expiryPreset struct {
+	Value		string
+	Label		string
+	Duration	time.Duration
+}
+
+/*	The values of the expires field that are not a preset duration	*/
+const (
+	ExpiryNever  = "never"
+	ExpiryCustom = "custom"
+)
+
+/*	expiryLayout is the format submitted by datetime-local inputs	*/
+const expiryLayout = "2006-01-02T15:04"
+
+var expiryPresets = []expiryPreset{
+	{Value: "10m", Label: "10 minutes", Duration: 10 * time.Minute},
+	{Value: "1h",  Label: "One hour",   Duration: time.Hour},
+	{Value: "1d",  Label: "One day",    Duration: 24 * time.Hour},
+	{Value: "1w",  Label: "One week",   Duration: 7 * 24 * time.Hour},
+	{Value: "1mo", Label: "One month",  Duration: 30 * 24 * time.Hour},
+	{Value: "1y",  Label: "One year",   Duration: 365 * 24 * time.Hour},
+	{Value: ExpiryNever, Label: "Never"},
+}
+
+/*	checkExpiry validates the expires and expires_at fields of a form, registering any
+	problem on `v`, and resolves them into the time the snippet should expire, counting
+	from `now`. A nil result means that the snippet never expires, or that the fields
+	are not valid	*/
+func checkExpiry(v *validator.Validator, value, at string, now time.Time) *time.Time {
+	if value == ExpiryCustom {
+		// Dates are entered and stored in UTC, which the form tells the user about
+		t, err := time.ParseInLocation(expiryLayout, at, time.UTC)
+		if err != nil {
+			v.AddFieldError("expires", "This field must be a valid date and time")
+			return nil
+		}
+
+		v.CheckField(t.After(now), "expires", "This field must be in the future")
+		return &t
+	}
+
+	for _, preset := range expiryPresets {
+		if preset.Value != value {
+			continue
+		}
+
+		if preset.Duration == 0 {
+			return nil
+		}
+
+		t := now.UTC().Add(preset.Duration)
+		return &t
+	}
+
+	v.AddFieldError("expires", "This field must be one of the listed durations or a date")
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"snippetbox.octaviorassi.net/internal/validator"
+)
+
+func TestCheckExpiry(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name	string
+		value	string
+		at		string
+		want	*time.Time
+		valid	bool
+	}{
+		{"preset", "1h", "", at(time.Hour), true},
+		{"longest preset", "1y", "", at(365 * 24 * time.Hour), true},
+		{"never", ExpiryNever, "", nil, true},
+		{"custom", ExpiryCustom, "2024-03-02T08:30", at(20*time.Hour + 30*time.Minute), true},
+		{"custom in the past", ExpiryCustom, "2024-03-01T11:59", at(-time.Minute), false},
+		{"custom right now", ExpiryCustom, "2024-03-01T12:00", at(0), false},
+		{"custom with a bad date", ExpiryCustom, "tomorrow", nil, false},
+		{"custom with no date", ExpiryCustom, "", nil, false},
+		{"unknown value", "2h", "", nil, false},
+		{"empty value", "", "", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v validator.Validator
+
+			got := checkExpiry(&v, tt.value, tt.at, now)
+
+			if v.Valid() != tt.valid {
+				t.Errorf("valid = %v, want %v (errors: %v)", v.Valid(), tt.valid, v.FieldErrors)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("checkExpiry = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckExpiryUTC(t *testing.T) {
+	// Presets count from `now` whatever its location, and come back in UTC
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("UTC+3", 3*60*60))
+
+	var v validator.Validator
+	got := checkExpiry(&v, "1d", "", now)
+
+	if got == nil || got.Location() != time.UTC || !got.Equal(now.Add(24*time.Hour)) {
+		t.Errorf("checkExpiry = %v, want %v in UTC", got, now.Add(24*time.Hour))
+	}
+}
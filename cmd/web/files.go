@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"snippetbox.octaviorassi.net/internal/highlight"
+	"snippetbox.octaviorassi.net/internal/models"
+	"snippetbox.octaviorassi.net/internal/validator"
+)
+
+// The most files a snippet can hold, its main file included
+const MaxFiles = 10
+
+/*	fileEntry is one of the files added to the create form besides the main one	*/
+type fileEntry struct {
+	Name		string	`form:"name"`
+	Content		string	`form:"content"`
+	Language	string	`form:"language"`
+}
+
+/*	renderedFile is a file of a snippet ready to be shown on its page	*/
+type renderedFile struct {
+	Name			string
+	Language		string
+	Rendered		renderedContent
+}
+
+/*	editFiles applies the add and remove file buttons of the create form, which post
+	the whole form back so that it works without scripts. It returns false if neither
+	was pressed, meaning the form was submitted for real	*/
+func (form *snippetCreateForm) editFiles() bool {
+	switch {
+	case form.AddFile:
+		if len(form.Files)+1 < MaxFiles {
+			form.Files = append(form.Files, fileEntry{Language: highlight.Auto})
+		}
+	case form.RemoveFile != nil:
+		if i := *form.RemoveFile; i >= 0 && i < len(form.Files) {
+			form.Files = append(form.Files[:i], form.Files[i+1:]...)
+		}
+	default:
+		return false
+	}
+
+	form.AddFile, form.RemoveFile = false, nil
+
+	return true
+}
+
+/*	checkFiles validates the main file's name and the extra files of the form. Every
+	file needs a name once there are several, and names cannot repeat	*/
+func (form *snippetCreateForm) checkFiles() {
+	form.CheckField(validator.MaxCount(form.Files, MaxFiles-1), "files",
+					fmt.Sprintf("A snippet cannot have more than %d files", MaxFiles))
+
+	if form.Filename != "" || len(form.Files) > 0 {
+		form.CheckField(validator.NotBlank(form.Filename), "filename",
+						"Name every file when there are several")
+		form.CheckField(form.Filename == "" || validator.Matches(form.Filename, validator.FilenameRx), "filename",
+						"File names can only contain letters, digits and . _ + - and cannot start with a dot")
+	}
+
+	names := map[string]bool{form.Filename: true}
+
+	for i, f := range form.Files {
+		key := fmt.Sprintf("files.%d", i)
+
+		form.CheckField(validator.NotBlank(f.Name), key,
+						"Name every file when there are several")
+		form.CheckField(validator.Matches(f.Name, validator.FilenameRx), key,
+						"File names can only contain letters, digits and . _ + - and cannot start with a dot")
+		form.CheckField(!names[f.Name], key,
+						"Another file already has this name")
+		form.CheckField(validator.NotBlank(f.Content), key,
+						"A file cannot be empty")
+		form.CheckField(len(f.Content) <= MaxContentSize, key,
+						fmt.Sprintf("A file cannot be larger than %s", humanSize(MaxContentSize)))
+		form.CheckField(validator.PermittedValue(f.Language, highlight.Names()...), key,
+						"The language must be one of the listed languages")
+
+		names[f.Name] = true
+	}
+}
+
+/*	modelFiles converts the extra files of the form for storage	*/
+func (form *snippetCreateForm) modelFiles() []models.File {
+	var files []models.File
+
+	for _, f := range form.Files {
+		files = append(files, models.File{Name: f.Name, Language: fileLanguage(f.Name, f.Language), Content: f.Content})
+	}
+
+	return files
+}
+
+/*	fileLanguage returns the language a file is highlighted as. Files left to be
+	detected automatically take the language their extension belongs to, if any	*/
+func fileLanguage(name, language string) string {
+	if language != highlight.Auto || path.Ext(name) == "" {
+		return language
+	}
+
+	if guess := highlight.ByExtension(path.Ext(name)); guess != highlight.Plain {
+		return guess
+	}
+
+	return language
+}
+
+/*	snippetFiles returns the files of `snippet`, naming its main file after the title
+	if it was given no name	*/
+func (app *application) snippetFiles(snippet models.Snippet) ([]models.File, error) {
+	files := append([]models.File{}, snippet.Files...)
+
+	if len(files) == 0 {
+		files = []models.File{{Language: snippet.Language, Content: snippet.Content, ContentKey: snippet.ContentKey}}
+	}
+	if files[0].Name == "" {
+		name, err := app.snippetFilename(snippet)
+		if err != nil {
+			return nil, err
+		}
+
+		files[0].Name = name
+	}
+
+	return files, nil
+}
+
+/*	renderFiles renders every file of `snippet`. The main file was already rendered,
+	as `main`, since it is also shown by itself	*/
+func (app *application) renderFiles(snippet models.Snippet, main renderedContent) ([]renderedFile, error) {
+	sources, err := app.snippetFiles(snippet)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []renderedFile
+
+	for i, f := range sources {
+		if i == 0 {
+			files = append(files, renderedFile{Name: f.Name, Language: f.Language, Rendered: main})
+			continue
+		}
+
+		content, truncated, err := app.shownFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		var rendered renderedContent
+
+		// Like the main file, files of snippets with limited views are not cached
+		if snippet.ViewsLeft > 0 {
+			rendered, err = renderUncached(content, f.Language)
+		} else {
+			rendered, err = app.renderSnippet(snippet.ID, snippet.Version, i, content, f.Language)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rendered.Truncated = truncated
+
+		files = append(files, renderedFile{Name: f.Name, Language: f.Language, Rendered: rendered})
+	}
+
+	return files, nil
+}
+
+/*	snippetRawFile writes one of the files of a snippet, found by its name, as plain
+	text	*/
+func (app *application) snippetRawFile(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.rawSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := app.snippetFiles(snippet)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	for _, f := range files {
+		if f.Name == r.PathValue("name") {
+			app.writeRaw(w, r, f.Content, f.ContentKey)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
@@ -1,23 +1,92 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
+	"snippetbox.octaviorassi.net/internal/highlight"
 	"snippetbox.octaviorassi.net/internal/models"
+	"snippetbox.octaviorassi.net/internal/search"
 	"snippetbox.octaviorassi.net/internal/validator"
 )
 
 const MinPassLength = 8
 
+// The maximum number of tags a snippet can have
+const MaxTags = 5
+
+// The largest page size that can be requested through the `limit` query parameter
+const MaxPageSize = 100
+
+// How many wrong passwords can be entered for a protected snippet within UnlockWindow
+const (
+	MaxUnlockAttempts = 5
+	UnlockWindow	  = 15 * time.Minute
+)
+
+// The largest number of views a snippet can be limited to
+const MaxViewsLimit = 1000
+
+// The largest content a snippet, or each of its files, can hold. It keeps the diffs
+// between versions cheap to compute
+const MaxContentSize = 256 << 10
+
+// The maximum number of search results shown, and the width of their excerpts
+const (
+	MaxSearchResults = 50
+	ExcerptWidth	 = 200
+)
+
 // The struct's fields must be exported in order to be read by the html/template package
 type snippetCreateForm struct {
 	Title		string	`form:"title"`
+	// The name, content and language of the main file
+	Filename	string	`form:"filename"`
 	Content		string	`form:"content"`
-	Expires		int		`form:"expires"`
+	Language	string	`form:"language"`
+	// Any other files, and the buttons adding and removing them
+	Files		[]fileEntry	`form:"files"`
+	AddFile		bool	`form:"add_file"`
+	RemoveFile	*int	`form:"remove_file"`
+	Visibility	string	`form:"visibility"`
+	Password	string	`form:"password"`
+	BurnAfterReading	bool	`form:"burn"`
+	MaxViews	int		`form:"max_views"`
+	Expires		string	`form:"expires"`
+	ExpiresAt	string	`form:"expires_at"`
+	Tags		string	`form:"tags"`
+	// The public id of the snippet being forked, if any
+	ForkOf		string	`form:"fork_of"`
+	validator.Validator	`form:"-"`
+}
+
+type snippetEditForm struct {
+	Title		string	`form:"title"`
+	Content		string	`form:"content"`
+	Version		int		`form:"version"`
+	validator.Validator	`form:"-"`
+}
+
+type snippetExpiryForm struct {
+	Expires		string	`form:"expires"`
+	ExpiresAt	string	`form:"expires_at"`
+	validator.Validator	`form:"-"`
+}
+
+type snippetUnlockForm struct {
+	Password	string	`form:"password"`
+	validator.Validator	`form:"-"`
+}
+
+type searchForm struct {
+	Q			string	`form:"q"`
 	validator.Validator	`form:"-"`
 }
 
@@ -37,30 +106,223 @@ type userLoginForm struct {
 
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
 
-	snippets, err := app.snippets.Latest()
+	page, err := app.snippets.List(models.Cursor{}, app.pageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.stars.SetCounts(page.Snippets)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
 	data := app.newTemplateData(r)
-	data.Snippets = snippets
+	data.Snippets = page.Snippets
+	data.Pagination = newPagination("/snippets", page, url.Values{})
 
 	app.render(w, r, http.StatusOK, "home.tmpl.html", data)
 }
 
+func (app *application) snippetArchive(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Keep any explicit page size on the pagination links
+	params := url.Values{}
+	limit := app.pageSize
+
+	if query.Has("limit") {
+		n, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || n < 1 || n > MaxPageSize {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		limit = n
+		params.Set("limit", query.Get("limit"))
+	}
+
+	var cursor models.Cursor
+
+	if query.Has("after") {
+		after, ok := queryPublicID(r, "after")
+		if !ok {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		cursor.After = after
+	} else if query.Has("before") {
+		before, ok := queryPublicID(r, "before")
+		if !ok {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		cursor.Before = before
+	}
+
+	page, err := app.snippets.List(cursor, limit)
+	if err != nil {
+		// Starting over from the first page would repeat snippets already seen
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.stars.SetCounts(page.Snippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = page.Snippets
+	data.Pagination = newPagination("/snippets", page, params)
+
+	app.render(w, r, http.StatusOK, "archive.tmpl.html", data)
+}
+
+func (app *application) searchSnippets(w http.ResponseWriter, r *http.Request) {
+	var form searchForm
+
+	err := app.formDecoder.Decode(&form, r.URL.Query())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	data := app.newTemplateData(r)
+
+	// Without a query, only render the search form
+	if !validator.NotBlank(form.Q) {
+		data.Form = form
+		app.render(w, r, http.StatusOK, "search.tmpl.html", data)
+		return
+	}
+
+	query := search.Parse(form.Q)
+
+	form.CheckField(validator.MaxChars(form.Q, 200), "q",
+					"This field cannot be more than 200 characters long")
+	form.CheckField(!query.Empty(), "q",
+					"Enter at least one word or phrase to search for")
+
+	if !form.Valid() {
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "search.tmpl.html", data)
+		return
+	}
+
+	results, err := app.snippets.Search(query, MaxSearchResults)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = form
+	data.Searched = true
+
+	for _, result := range results {
+		data.Results = append(data.Results, searchResult{
+			Snippet: result.Snippet,
+			Title:	 search.Highlight(result.Title, query),
+			Excerpt: search.Excerpt(result.Content, query, ExcerptWidth),
+		})
+	}
+
+	app.render(w, r, http.StatusOK, "search.tmpl.html", data)
+}
+
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
-	// Extract the id from the path's wildcard value
-	id, err := strconv.Atoi(r.PathValue("id"))
-	if err != nil || id < 1 {
+	// Snippets used to be reachable by their numeric id, so keep those links working
+	if id, err := strconv.Atoi(r.PathValue("id")); err == nil {
+		app.legacySnippetRedirect(w, r, id)
+		return
+	}
+
+	publicID, ok := pathPublicID(r, "id")
+	if !ok {
 		app.clientError(w, http.StatusNotFound)
 		return
 	}
 
-	// Query the DB for the ID and check for possible errors
-	snippet, err := app.snippets.Get(id)
+	// Query the DB for the snippet and check whether the user is allowed to see it
+	snippet, ok := app.viewableSnippet(w, r, publicID)
+	if !ok {
+		return
+	}
+
+	app.setNoIndex(w, snippet)
+
+	// Protected snippets only show their title until the password is entered
+	if !app.isUnlocked(r, snippet) {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = snippetUnlockForm{}
+		data.NoIndex = true
+		app.render(w, r, http.StatusOK, "unlock.tmpl.html", data)
+		return
+	}
+
+	// Snippets with limited views are only shown once the reader asks for it, so that
+	// merely opening the link, as chat link previews do, does not use up a view. Their
+	// owner can always see them without using any
+	if snippet.ViewsLeft > 0 && !app.ownsSnippet(r, snippet) {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.NoIndex = true
+		app.render(w, r, http.StatusOK, "reveal.tmpl.html", data)
+		return
+	}
+
+	var err error
+	snippet.Tags, err = app.tags.ForSnippet(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	rendered, err := app.renderMain(snippet)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.showSnippet(w, r, snippet, rendered)
+}
+
+func (app *application) snippetRevealPost(w http.ResponseWriter, r *http.Request) {
+	publicID, ok := pathPublicID(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	snippet, ok := app.viewableSnippet(w, r, publicID)
+	if !ok {
+		return
+	}
+
+	// Only readers of a snippet with limited views need to reveal it
+	if !app.isUnlocked(r, snippet) || snippet.ViewsLeft == 0 || app.ownsSnippet(r, snippet) {
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", publicID), http.StatusSeeOther)
+		return
+	}
+
+	// Tags are deleted along with the snippet, so fetch them before its last view
+	tags, err := app.tags.ForSnippet(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Count the view. If someone else used up the last view in the meantime, the
+	// snippet is already gone
+	snippet, err = app.snippets.View(publicID)
 	if err != nil {
-		// Check if no rows were found
 		if errors.Is(err, models.ErrNoRecord) {
 			http.NotFound(w, r)
 		} else {
@@ -69,11 +331,189 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	rendered, err := app.renderMain(snippet)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	snippet.Tags = tags
+
+	// Neither the browser nor any proxy should keep a copy of the page
+	w.Header().Set("Cache-Control", "no-store")
+
+	if snippet.ViewsLeft > 1 {
+		snippet.ViewsLeft--
+		app.showSnippet(w, r, snippet, rendered)
+		return
+	}
+
+	// The last view deleted the snippet along with its comments, annotations,
+	// attachments and stars, so the page only shows what was loaded before that
+	data, err := app.snippetPage(r, snippet, rendered, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Snippet.ViewsLeft = 0
+	data.NoIndex = true
+	data.Flash = "This snippet has now been deleted. Copy anything you need before leaving this page."
+
+	app.render(w, r, http.StatusOK, "view.tmpl.html", data)
+}
+
+/*	snippetPage returns the data of the page of a snippet the user is allowed to read,
+	filled with its content, files and the given annotations	*/
+func (app *application) snippetPage(r *http.Request, snippet models.Snippet, rendered renderedContent, annotations []models.Annotation) (templateData, error) {
+	files, err := app.renderFiles(snippet, rendered)
+	if err != nil {
+		return templateData{}, err
+	}
+
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
-	
+	data.Rendered = rendered
+	data.Files = files
+	data.Blocks, data.Annotations = annotateLines(rendered, annotations)
+	data.NoIndex = snippet.Visibility != models.VisibilityPublic || snippet.ViewsLeft > 0
+
+	return data, nil
+}
+
+/*	showSnippet renders the page of a snippet the user is allowed to read, along with
+	its comments, annotations, attachments, stars and forks	*/
+func (app *application) showSnippet(w http.ResponseWriter, r *http.Request, snippet models.Snippet, rendered renderedContent) {
+	forks, err := app.snippets.ForkCount(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Only link to the snippet this one was forked from if the link would not reveal
+	// an unlisted or private snippet to people it was not shared with
+	var parent models.Snippet
+	if snippet.ParentID != 0 {
+		parent, err = app.snippets.Get(snippet.ParentID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if parent.Visibility != models.VisibilityPublic && !app.ownsSnippet(r, parent) {
+			parent = models.Snippet{}
+		}
+	}
+
+	comments, err := app.comments.ForSnippet(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	annotations, err := app.annotations.ForSnippet(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	attachments, err := app.attachments.ForSnippet(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	snippet.Stars, err = app.stars.Count(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var starred bool
+	if app.isAuthenticated(r) {
+		starred, err = app.stars.Starred(app.authenticatedUserID(r), snippet.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	data, err := app.snippetPage(r, snippet, rendered, annotations)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Parent = parent
+	data.Forks = forks
+	data.Starred = starred
+	data.Comments = flattenThreads(comments, 0)
+	data.Attachments = attachments
+
 	app.render(w, r, http.StatusOK, "view.tmpl.html", data)
+}
+
+func (app *application) snippetUnlockPost(w http.ResponseWriter, r *http.Request) {
+	publicID, ok := pathPublicID(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	snippet, ok := app.viewableSnippet(w, r, publicID)
+	if !ok {
+		return
+	}
+
+	if app.isUnlocked(r, snippet) {
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", publicID), http.StatusSeeOther)
+		return
+	}
+
+	var form snippetUnlockForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	app.setNoIndex(w, snippet)
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.NoIndex = true
+
+	// Throttle the attempts on each snippet, so that its password cannot be brute forced
+	allowed, attempt, retryAfter := app.unlockLimiter.Allow(publicID)
+	if !allowed {
+		form.AddNonFieldError("Too many incorrect passwords. Please try again later.")
+		data.Form = form
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds()) + 1))
+		app.render(w, r, http.StatusTooManyRequests, "unlock.tmpl.html", data)
+		return
+	}
+
+	err = snippet.CheckPassword(form.Password)
+	if err != nil {
+		// The attempt stays counted as a failure
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("password", "Incorrect password")
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "unlock.tmpl.html", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.unlockLimiter.Succeed(publicID, attempt)
+
+	// Remember the unlock for this snippet only, for as long as the session lasts
+	app.sessionManager.Put(r.Context(), unlockedKey(publicID), true)
 
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", publicID), http.StatusSeeOther)
 }
 
 func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
@@ -205,7 +645,7 @@ func (app *application) userLogOutPost(w http.ResponseWriter, r *http.Request) {
 
 
 	// We only have to remove the user's authenticatedUserId header
-	app.sessionManager.Remove(r.Context(), "authenticatedUserId")
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
 
 	// Notify them through a flash message
 	app.sessionManager.Put(r.Context(), "flash", "You've been logged out sucessfully")
@@ -219,18 +659,23 @@ func (app *application) userLogOutPost(w http.ResponseWriter, r *http.Request) {
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 
 	/* 	We must pass an initialized templateData with a non-nil Form in order to have
-	the template correctly render the first time. We set a default 365 expire time	*/
+	the template correctly render the first time. We set a default one year expire time	*/
 
 	data := app.newTemplateData(r)
-	data.Form = snippetCreateForm{ Expires: 365, }
+	data.Form = snippetCreateForm{
+		Expires:	"1y",
+		Language:	highlight.Auto,
+		Visibility: models.VisibilityPublic,
+	}
 
 	app.render(w, r, http.StatusOK, "create.tmpl.html", data)
 	
 }
 
 
-func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
-	// The decode method fills the form fields with their corresponding values from the HTML form
+/*	snippetPreview re-renders the create form along with how its content will look once
+	published, without saving anything	*/
+func (app *application) snippetPreview(w http.ResponseWriter, r *http.Request) {
 	var form snippetCreateForm
 
 	err := app.decodePostForm(r, &form)
@@ -238,35 +683,685 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
-	
-	// Validate the fields
-	form.CheckField(validator.NotBlank(form.Title), "title",
-					"This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title",
-					"This field cannot be more than 100 characters long")
+
 	form.CheckField(validator.NotBlank(form.Content), "content",
 					"This field cannot be blank")
-	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires",
-					"This field must be equal to 1, 7, or 365")
+	form.CheckField(len(form.Content) <= MaxContentSize, "content",
+					fmt.Sprintf("This field cannot be larger than %s", humanSize(MaxContentSize)))
+	form.CheckField(validator.PermittedValue(form.Language, highlight.Names()...), "language",
+					"This field must be one of the listed languages")
+
+	data := app.newTemplateData(r)
+	data.Form = form
 
-	// Check for any errors. If there are any, re-render the template highlighting them
 	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
 		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl.html", data)
 		return
 	}
 
-	// Else, insert the snippet and redirect the user
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	// Previews are not cached, since they are thrown away right after
+	html, err := renderContent(form.Content, form.Language)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	// Add the flash message to the session data
-	app.sessionManager.Put(r.Context(), "flash", "Snippet sucessfully created!")
+	data.Rendered = renderedContent{HTML: html, Markdown: form.Language == highlight.Markdown}
+	data.Preview = true
+
+	app.render(w, r, http.StatusOK, "create.tmpl.html", data)
+}
+
+func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
+	// The decode method fills the form fields with their corresponding values from the HTML form
+	var form snippetCreateForm
 
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Adding or removing a file only shows the form again with the change
+	if form.editFiles() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusOK, "create.tmpl.html", data)
+		return
+	}
+	
+	// Validate the fields
+	form.CheckField(validator.NotBlank(form.Title), "title",
+					"This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title",
+					"This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content",
+					"This field cannot be blank")
+	form.CheckField(len(form.Content) <= MaxContentSize, "content",
+					fmt.Sprintf("This field cannot be larger than %s", humanSize(MaxContentSize)))
+	form.CheckField(validator.PermittedValue(form.Language, highlight.Names()...), "language",
+					"This field must be one of the listed languages")
+	form.CheckField(validator.PermittedValue(form.Visibility, models.VisibilityPublic,
+					models.VisibilityUnlisted, models.VisibilityPrivate), "visibility",
+					"This field must be public, unlisted or private")
+
+	form.checkFiles()
+
+	form.CheckField(validator.InRange(form.MaxViews, 0, MaxViewsLimit), "max_views",
+					fmt.Sprintf("This field must be between 0 and %d", MaxViewsLimit))
+
+	expires := checkExpiry(&form.Validator, form.Expires, form.ExpiresAt, time.Now())
+
+	// The password is optional, but when given it must not be trivial to guess
+	if form.Password != "" {
+		form.CheckField(validator.MinChars(form.Password, MinPassLength), "password",
+						fmt.Sprintf("This field must be at least %d characters long", MinPassLength))
+	}
+
+	tags := models.ParseTags(form.Tags)
+	form.CheckField(validator.MaxCount(tags, MaxTags), "tags",
+					fmt.Sprintf("This field cannot have more than %d tags", MaxTags))
+	form.CheckField(validator.AllMatch(tags, validator.TagRx), "tags",
+					"Tags can only contain lowercase letters, digits and + # . _ - and be up to 30 characters long")
+
+	var uploads []upload
+	if r.MultipartForm != nil {
+		uploads, err = checkAttachments(&form.Validator, r.MultipartForm.File["attachments"])
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// Attachments are served on their own URLs, which would outlive a limited view
+	if len(uploads) > 0 && (form.BurnAfterReading || form.MaxViews > 0) {
+		form.AddFieldError("attachments", "Snippets with limited views cannot have attachments")
+	}
+
+	// Forks record the snippet they come from, which the user must still be able to read
+	parentID := 0
+	if form.ForkOf != "" {
+		parent, err := app.snippets.GetByPublicID(form.ForkOf)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if err != nil || !app.canRead(r, parent) {
+			form.AddNonFieldError("The snippet you are forking is no longer available")
+		} else {
+			parentID = parent.ID
+		}
+	}
+
+	// Check for any errors. If there are any, re-render the template highlighting them
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl.html", data)
+		return
+	}
+
+	// Burning a snippet after reading is the same as allowing a single view
+	maxViews := form.MaxViews
+	if form.BurnAfterReading {
+		maxViews = 1
+	}
+
+	// The attachments' data has to be in the blob store before they are recorded
+	attachments, err := app.putAttachments(uploads)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Else, insert the snippet on behalf of the logged in user and redirect them
+	_, publicID, err := app.snippets.Insert(models.NewSnippet{
+		UserID:		 app.authenticatedUserID(r),
+		ParentID:	 parentID,
+		Title:		 form.Title,
+		Filename:	 form.Filename,
+		Content:	 form.Content,
+		Language:	 fileLanguage(form.Filename, form.Language),
+		Files:		 form.modelFiles(),
+		Visibility:	 form.Visibility,
+		Password:	 form.Password,
+		MaxViews:	 maxViews,
+		Expires:	 expires,
+		Tags:		 tags,
+		Attachments: attachments,
+	})
+	if err != nil {
+		app.deleteAttachments(attachments)
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Add the flash message to the session data
+	app.sessionManager.Put(r.Context(), "flash", "Snippet sucessfully created!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", publicID), http.StatusSeeOther)
+
+}
+
+/*	snippetFork shows the create form filled in with a copy of the snippet reachable by
+	the request's id wildcard. Publishing it goes through snippetCreatePost like any
+	other snippet	*/
+func (app *application) snippetFork(w http.ResponseWriter, r *http.Request) {
+	publicID, ok := pathPublicID(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	parent, ok := app.unlockedSnippet(w, r, publicID)
+	if !ok {
+		return
+	}
+
+	// The copy needs the whole body, wherever it is kept
+	err := app.snippets.LoadContent(&parent)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	tags, err := app.tags.ForSnippet(parent.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	form := snippetCreateForm{
+		Title:		parent.Title,
+		Content:	parent.Content,
+		Language:	parent.Language,
+		Visibility:	models.VisibilityPublic,
+		Expires:	"1y",
+		Tags:		strings.Join(tags, ", "),
+		ForkOf:		parent.PublicID,
+	}
+
+	// Only name the main file if the parent did, or if it has other files to tell apart
+	if len(parent.Files) > 1 || parent.Files[0].Name != "" {
+		files, err := app.snippetFiles(parent)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		form.Filename = files[0].Name
+
+		for _, f := range files[1:] {
+			form.Files = append(form.Files, fileEntry{Name: f.Name, Content: f.Content, Language: f.Language})
+		}
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+
+	app.render(w, r, http.StatusOK, "create.tmpl.html", data)
+}
+
+func (app *application) userSnippets(w http.ResponseWriter, r *http.Request) {
+
+	snippets, err := app.snippets.ByUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+
+	app.render(w, r, http.StatusOK, "dashboard.tmpl.html", data)
+}
+
+/*	legacySnippetRedirect permanently redirects a numeric snippet URL to the snippet's
+	public id. Only public snippets are redirected, since they are listed anyway: for
+	any other snippet it would reveal the id its owner chose not to share	*/
+func (app *application) legacySnippetRedirect(w http.ResponseWriter, r *http.Request, id int) {
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if snippet.Visibility != models.VisibilityPublic {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.PublicID), http.StatusMovedPermanently)
+}
+
+/*	viewableSnippet fetches the snippet reachable by `publicID` and checks that the user
+	is allowed to see it. Private snippets are only visible to their owner, and look as
+	if they did not exist to everyone else. If anything fails, the error response is
+	written and the second return value is false	*/
+func (app *application) viewableSnippet(w http.ResponseWriter, r *http.Request, publicID string) (models.Snippet, bool) {
+	snippet, err := app.snippets.GetByPublicID(publicID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	if snippet.Visibility == models.VisibilityPrivate && !app.ownsSnippet(r, snippet) {
+		http.NotFound(w, r)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+/*	unlockedSnippet is like viewableSnippet, but it also requires password protected
+	snippets to have been unlocked, and refuses snippets with limited views to anyone
+	but their owner. Otherwise the user is sent to the snippet's page, where the
+	password can be entered or the snippet revealed	*/
+func (app *application) unlockedSnippet(w http.ResponseWriter, r *http.Request, publicID string) (models.Snippet, bool) {
+	snippet, ok := app.viewableSnippet(w, r, publicID)
+	if !ok {
+		return models.Snippet{}, false
+	}
+
+	// Snippets with limited views can only be read by revealing them on their page
+	if !app.isUnlocked(r, snippet) || (snippet.ViewsLeft > 0 && !app.ownsSnippet(r, snippet)) {
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", publicID), http.StatusSeeOther)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+/*	canRead returns true if the user may read the content of `snippet` without any
+	further step, which is what unlockedSnippet requires	*/
+func (app *application) canRead(r *http.Request, snippet models.Snippet) bool {
+	owner := app.ownsSnippet(r, snippet)
+
+	return (snippet.Visibility != models.VisibilityPrivate || owner) &&
+		   app.isUnlocked(r, snippet) &&
+		   (snippet.ViewsLeft == 0 || owner)
+}
+
+/*	setNoIndex asks search engines not to index pages showing a snippet which is not
+	public	*/
+func (app *application) setNoIndex(w http.ResponseWriter, snippet models.Snippet) {
+	if snippet.Visibility != models.VisibilityPublic {
+		w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+	}
+}
+
+/*	ownedSnippet fetches the snippet reachable by the request's id wildcard and checks
+	that it belongs to the logged in user. If anything fails, the error response is
+	written and the second return value is false	*/
+func (app *application) ownedSnippet(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	publicID, ok := pathPublicID(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return models.Snippet{}, false
+	}
+
+	snippet, err := app.snippets.GetByPublicID(publicID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	if !app.ownsSnippet(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.LoadContent(&snippet)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetEditForm{
+		Title:   snippet.Title,
+		Content: snippet.Content,
+		Version: snippet.Version,
+	}
+
+	app.render(w, r, http.StatusOK, "edit.tmpl.html", data)
+}
+
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetEditForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Title), "title",
+					"This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title",
+					"This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content",
+					"This field cannot be blank")
+	form.CheckField(len(form.Content) <= MaxContentSize, "content",
+					fmt.Sprintf("This field cannot be larger than %s", humanSize(MaxContentSize)))
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "edit.tmpl.html", data)
+		return
+	}
+
+	err = app.snippets.Update(snippet.ID, snippet.UserID, form.Version, form.Title, form.Content)
+	if err != nil {
+		if errors.Is(err, models.ErrEditConflict) {
+			// Show the latest version and let the user decide whether to overwrite it
+			err = app.snippets.LoadContent(&snippet)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			form.AddNonFieldError("This snippet was modified while you were editing it. " +
+								  "Review the latest version below and save again to overwrite it.")
+			form.Version = snippet.Version
+
+			data := app.newTemplateData(r)
+			data.Snippet = snippet
+			data.Form = form
+			app.render(w, r, http.StatusConflict, "edit.tmpl.html", data)
+		} else if errors.Is(err, models.ErrNoRecord) {
+			// The snippet expired or was deleted while it was being edited
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet sucessfully updated!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.PublicID), http.StatusSeeOther)
+}
+
+func (app *application) snippetExpiry(w http.ResponseWriter, r *http.Request) {
+
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetExpiryForm{Expires: "1y"}
+
+	app.render(w, r, http.StatusOK, "expiry.tmpl.html", data)
+}
+
+func (app *application) snippetExpiryPost(w http.ResponseWriter, r *http.Request) {
+
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetExpiryForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	expires := checkExpiry(&form.Validator, form.Expires, form.ExpiresAt, time.Now())
+
+	// The expiry can only be pushed back. Deleting the snippet is the way to get rid of it sooner
+	if snippet.Expires == nil {
+		form.AddNonFieldError("This snippet already never expires")
+	} else if form.Valid() {
+		form.CheckField(expires == nil || expires.After(*snippet.Expires), "expires",
+						"This field must be later than the current expiry")
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "expiry.tmpl.html", data)
+		return
+	}
+
+	err = app.snippets.SetExpiry(snippet.ID, snippet.UserID, expires)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet expiry sucessfully extended!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.PublicID), http.StatusSeeOther)
+}
+
+func (app *application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	publicID, ok := pathPublicID(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	snippet, ok := app.unlockedSnippet(w, r, publicID)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.snippets.Revisions(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.setNoIndex(w, snippet)
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+	data.NoIndex = snippet.Visibility != models.VisibilityPublic
+
+	app.render(w, r, http.StatusOK, "history.tmpl.html", data)
+}
+
+func (app *application) snippetRevision(w http.ResponseWriter, r *http.Request) {
+	publicID, ok := pathPublicID(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	version, ok := pathID(r, "version")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	snippet, ok := app.unlockedSnippet(w, r, publicID)
+	if !ok {
+		return
+	}
+
+	// The current version is not stored as a revision, so send the user to the snippet itself
+	if version == snippet.Version {
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", publicID), http.StatusSeeOther)
+		return
+	}
+
+	revision, err := app.snippets.Revision(snippet.ID, version)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	revision.Content, err = app.snippets.ReadContent(revision.Content, revision.ContentKey)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	rendered, err := app.renderSnippet(snippet.ID, revision.Version, 0, revision.Content, snippet.Language)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.setNoIndex(w, snippet)
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revision = revision
+	data.Rendered = rendered
+	data.NoIndex = snippet.Visibility != models.VisibilityPublic
+
+	app.render(w, r, http.StatusOK, "revision.tmpl.html", data)
+}
+
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Delete(snippet.ID, snippet.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet moved to the trash.")
+
+	http.Redirect(w, r, "/user/snippets", http.StatusSeeOther)
+}
+
+func (app *application) userTrash(w http.ResponseWriter, r *http.Request) {
+
+	snippets, err := app.snippets.Trash(app.authenticatedUserID(r), app.trashWindow)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.TrashWindow = app.trashWindow
+
+	app.render(w, r, http.StatusOK, "trash.tmpl.html", data)
+}
+
+func (app *application) snippetRestorePost(w http.ResponseWriter, r *http.Request) {
+	publicID, ok := pathPublicID(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	// Restore only matches snippets owned by the user, so it also acts as the ownership check
+	err := app.snippets.Restore(publicID, app.authenticatedUserID(r), app.trashWindow)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet sucessfully restored!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", publicID), http.StatusSeeOther)
+}
+
+func (app *application) tagView(w http.ResponseWriter, r *http.Request) {
+	tag := r.PathValue("name")
+
+	if !validator.Matches(tag, validator.TagRx) {
+		http.NotFound(w, r)
+		return
+	}
+
+	snippets, err := app.snippets.ByTag(tag)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.stars.SetCounts(snippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tag = tag
+	data.Snippets = snippets
+
+	app.render(w, r, http.StatusOK, "tag.tmpl.html", data)
+}
+
+/*	tagSuggest responds with a JSON array of the most used tags starting with the `q`
+	query parameter, for the create form's autocomplete	*/
+func (app *application) tagSuggest(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+
+	tags := []string{}
+
+	if prefix != "" && validator.MaxChars(prefix, 30) {
+		suggestions, err := app.tags.Suggest(prefix, 10)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		tags = append(tags, suggestions...)
+	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
 }
@@ -4,10 +4,17 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"html/template"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-playground/form/v4"
+
+	"snippetbox.octaviorassi.net/internal/highlight"
+	"snippetbox.octaviorassi.net/internal/markdown"
+	"snippetbox.octaviorassi.net/internal/models"
 )
 
 /*	isAuthenticated returns true if the given request has an authenticatedUserId header,
@@ -24,9 +31,126 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 
 }
 
+/*	authenticatedUserID returns the id of the user logged in on the given request's session,
+	or 0 if there is none	*/
+func (app *application) authenticatedUserID(r *http.Request) int {
+	// Ignore ids which the authenticate middleware could not match to a user
+	if !app.isAuthenticated(r) {
+		return 0
+	}
+
+	return app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+}
+
+/*	ownsSnippet returns true if `snippet` belongs to the user logged in on the given
+	request. Snippets created before they had owners belong to nobody	*/
+func (app *application) ownsSnippet(r *http.Request, snippet models.Snippet) bool {
+	return snippet.UserID != 0 && snippet.UserID == app.authenticatedUserID(r)
+}
+
+/*	pathID parses the path wildcard `name` as a positive integer id. The second return
+	value is false if it is missing or malformed	*/
+func pathID(r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil || id < 1 {
+		return 0, false
+	}
+
+	return id, true
+}
+
+/*	queryID parses the query string parameter `name` as a positive integer id. The
+	second return value is false if it is missing or malformed	*/
+func queryID(r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || id < 1 {
+		return 0, false
+	}
+
+	return id, true
+}
+
+/*	isUnlocked returns true if the content of `snippet` can be shown on the given request:
+	it is not password protected, it belongs to the logged in user, or its password was
+	entered earlier on the same session	*/
+func (app *application) isUnlocked(r *http.Request, snippet models.Snippet) bool {
+	if !snippet.Protected() || app.ownsSnippet(r, snippet) {
+		return true
+	}
+
+	return app.sessionManager.GetBool(r.Context(), unlockedKey(snippet.PublicID))
+}
+
+/*	unlockedKey is the session key remembering that the snippet reachable by `publicID`
+	was unlocked	*/
+func unlockedKey(publicID string) string {
+	return "unlockedSnippet:" + publicID
+}
+
+/*	pathPublicID reads the path wildcard `name` as a snippet's public id. The second
+	return value is false if it is missing or malformed	*/
+func pathPublicID(r *http.Request, name string) (string, bool) {
+	publicID := r.PathValue(name)
+	return publicID, models.ValidPublicID(publicID)
+}
+
+/*	queryPublicID reads the query string parameter `name` as a snippet's public id. The
+	second return value is false if it is missing or malformed	*/
+func queryPublicID(r *http.Request, name string) (string, bool) {
+	publicID := r.URL.Query().Get(name)
+	return publicID, models.ValidPublicID(publicID)
+}
+
+/*	renderContent returns the HTML shown for a snippet's content: Markdown documents
+	are rendered and sanitized, anything else is syntax highlighted	*/
+func renderContent(content, language string) (template.HTML, error) {
+	if language == highlight.Markdown {
+		return markdown.Render(content)
+	}
+	return highlight.Highlight(content, language), nil
+}
+
+/*	renderSnippet returns the rendered content of a given version of one of the files of
+	a snippet, 0 being its main file, reusing the cached output if it was already
+	rendered	*/
+func (app *application) renderSnippet(id, version, file int, content, language string) (renderedContent, error) {
+	key := fmt.Sprintf("%d:%d:%d:%s", id, version, file, language)
+
+	html, err := app.renders.Get(key, func() (template.HTML, error) {
+		return renderContent(content, language)
+	})
+	if err != nil {
+		return renderedContent{}, err
+	}
+
+	return renderedContent{HTML: html, Markdown: language == highlight.Markdown}, nil
+}
+
+/*	renderUncached renders content like renderSnippet, without going through the cache.
+	It is used for snippets with limited views, whose content must not outlive them	*/
+func renderUncached(content, language string) (renderedContent, error) {
+	html, err := renderContent(content, language)
+	if err != nil {
+		return renderedContent{}, err
+	}
+
+	return renderedContent{HTML: html, Markdown: language == highlight.Markdown}, nil
+}
+
+/*	parseForm parses the request's form. Forms with file uploads also fill r.PostForm
+	with their other fields, and keep the files in r.MultipartForm, spilling them to
+	disk past MaxUploadMemory. Parsing a form that was already parsed does nothing	*/
+func parseForm(r *http.Request) error {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return r.ParseMultipartForm(MaxUploadMemory)
+	}
+
+	return r.ParseForm()
+}
+
 func (app *application) decodePostForm(r *http.Request, dst any) error {
-	// Parse the form
-	err := r.ParseForm()
+	// Parse the form, unless limitBody already did
+	err := parseForm(r)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"snippetbox.octaviorassi.net/internal/highlight"
+	"snippetbox.octaviorassi.net/internal/models"
+	"snippetbox.octaviorassi.net/internal/validator"
+)
+
+// The most files a single import can create snippets from, how large each of them
+// can be and how much they can add up to once extracted
+const (
+	MaxImportFiles		= 50
+	MaxImportFileSize	= MaxContentSize
+	MaxImportSize		= 4 << 20
+)
+
+// How much a tar.gz archive can be decompressed into, counting the files that are left
+// out and the archive's own headers
+const MaxImportExpandedSize = 4 * MaxImportSize
+
+// The largest import request accepted, leaving room for the fields besides the files
+const MaxImportUploadSize = MaxImportSize + (1 << 20)
+
+/*	importForm is posted twice: first with the uploaded file, to preview the snippets
+	it holds, and then with those snippets as reviewed by the user, to create them	*/
+type importForm struct {
+	Files		[]importEntry	`form:"files"`
+	Visibility	string	`form:"visibility"`
+	Expires		string	`form:"expires"`
+	ExpiresAt	string	`form:"expires_at"`
+	// Set by the button that creates the snippets once they have been previewed
+	Confirm		bool	`form:"confirm"`
+	validator.Validator	`form:"-"`
+}
+
+/*	importEntry is a file of an import, which becomes a snippet of its own. Each entry
+	keeps its own errors, so that they are shown next to the file they are about	*/
+type importEntry struct {
+	// Where the file was found within the upload, to tell apart files with the same name
+	Path		string	`form:"path"`
+	Title		string	`form:"title"`
+	Filename	string	`form:"filename"`
+	Language	string	`form:"language"`
+	Content		string	`form:"content"`
+	// Whether a snippet is created from the file. Files with problems are left out
+	// until they are fixed
+	Include		bool	`form:"include"`
+	validator.Validator	`form:"-"`
+}
+
+/*	Size returns the size of the entry's content in bytes, for the preview	*/
+func (e importEntry) Size() int64 {
+	return int64(len(e.Content))
+}
+
+/*	Lines returns how many lines the entry's content has, for the preview	*/
+func (e importEntry) Lines() int {
+	n, _ := lineCount(strings.NewReader(e.Content))
+	return n
+}
+
+/*	check validates the entry as it is about to become a snippet	*/
+func (e *importEntry) check() {
+	e.CheckField(validator.NotBlank(e.Title), "title",
+				 "This field cannot be blank")
+	e.CheckField(validator.MaxChars(e.Title, 100), "title",
+				 "This field cannot be more than 100 characters long")
+	e.CheckField(e.Filename == "" || validator.Matches(e.Filename, validator.FilenameRx), "filename",
+				 "File names can only contain letters, digits and . _ + - and cannot start with a dot")
+	e.CheckField(validator.PermittedValue(e.Language, highlight.Names()...), "language",
+				 "This field must be one of the listed languages")
+	e.CheckField(validator.NotBlank(e.Content), "content",
+				 "The file is empty")
+	e.CheckField(len(e.Content) <= MaxImportFileSize, "content",
+				 fmt.Sprintf("The file is larger than %s", humanSize(MaxImportFileSize)))
+	e.CheckField(utf8.ValidString(e.Content) && !strings.ContainsRune(e.Content, 0), "content",
+				 "The file is not a text file")
+}
+
+/*	newImportEntry turns a file found in an upload into an entry, deriving the title of
+	its snippet from the file name and the language from its extension	*/
+func newImportEntry(filePath, content string) importEntry {
+	name := path.Base(filePath)
+
+	title := strings.TrimSuffix(name, path.Ext(name))
+	if strings.TrimSpace(title) == "" {
+		title = name
+	}
+	if utf8.RuneCountInString(title) > 100 {
+		title = string([]rune(title)[:100])
+	}
+
+	return importEntry{
+		Path:		filePath,
+		Title:		title,
+		Filename:	name,
+		Language:	fileLanguage(name, highlight.Auto),
+		Content:	content,
+	}
+}
+
+func (app *application) snippetImport(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = importForm{
+		Expires:	"1y",
+		Visibility:	models.VisibilityPublic,
+	}
+
+	app.render(w, r, http.StatusOK, "import.tmpl.html", data)
+}
+
+/*	snippetImportPost previews the snippets held by an uploaded file or, once they
+	have been previewed, creates them	*/
+func (app *application) snippetImportPost(w http.ResponseWriter, r *http.Request) {
+	var form importForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.PermittedValue(form.Visibility, models.VisibilityPublic,
+					models.VisibilityUnlisted, models.VisibilityPrivate), "visibility",
+					"This field must be public, unlisted or private")
+
+	expires := checkExpiry(&form.Validator, form.Expires, form.ExpiresAt, time.Now())
+
+	// Anything but the import button previews the files again: those of a new upload,
+	// or the ones already previewed as the user changed them
+	if !form.Confirm {
+		var headers []*multipart.FileHeader
+		if r.MultipartForm != nil {
+			headers = r.MultipartForm.File["upload"]
+		}
+
+		switch {
+		case len(headers) == 1:
+			form.Files, err = readImport(&form.Validator, headers[0])
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+		case len(headers) == 0 && len(form.Files) > 0:
+			for i := range form.Files {
+				if form.Files[i].Include {
+					form.Files[i].check()
+				}
+			}
+		default:
+			form.Files = nil
+			form.AddFieldError("upload", "Choose a text file, or a zip or tar.gz archive of text files")
+		}
+
+		status := http.StatusOK
+		if !form.Valid() {
+			status = http.StatusUnprocessableEntity
+		}
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, status, "import.tmpl.html", data)
+		return
+	}
+
+	included := 0
+	for i := range form.Files {
+		if form.Files[i].Include {
+			form.Files[i].check()
+			included++
+
+			if !form.Files[i].Valid() {
+				form.AddFieldError("files", "Fix the files below, or leave them out of the import")
+			}
+		}
+	}
+
+	form.CheckField(included > 0, "files", "Choose at least one file to import")
+	form.CheckField(len(form.Files) <= MaxImportFiles, "files",
+					fmt.Sprintf("An import cannot have more than %d files", MaxImportFiles))
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "import.tmpl.html", data)
+		return
+	}
+
+	var snippets []models.NewSnippet
+
+	for _, e := range form.Files {
+		if !e.Include {
+			continue
+		}
+
+		snippets = append(snippets, models.NewSnippet{
+			UserID:		app.authenticatedUserID(r),
+			Title:		e.Title,
+			Filename:	e.Filename,
+			Content:	e.Content,
+			Language:	fileLanguage(e.Filename, e.Language),
+			Visibility:	form.Visibility,
+			Expires:	expires,
+		})
+	}
+
+	// Either every snippet of the import is created or none is
+	err = app.snippets.InsertMany(snippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Imported %d snippets!", included))
+
+	http.Redirect(w, r, "/user/snippets", http.StatusSeeOther)
+}
+
+/*	readImport extracts the files of an upload, which is either a single text file or
+	a zip or tar.gz archive of them. Problems with the upload as a whole are added to
+	`v` under the "upload" key, while those with single files are kept in their entry.
+	Only failures to read the upload are returned as errors	*/
+func readImport(v *validator.Validator, h *multipart.FileHeader) ([]importEntry, error) {
+	f, err := h.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	// Tell archives apart by their first bytes rather than by their name
+	magic := make([]byte, 4)
+
+	n, err := io.ReadFull(f, magic)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	imp := &importer{v: v}
+
+	switch {
+	case bytes.HasPrefix(magic[:n], []byte("PK\x03\x04")), bytes.HasPrefix(magic[:n], []byte("PK\x05\x06")):
+		err = imp.readZip(f, h.Size)
+	case bytes.HasPrefix(magic[:n], []byte{0x1f, 0x8b}):
+		err = imp.readTarGz(f)
+	default:
+		err = imp.add(attachmentName(h.Filename), f)
+	}
+
+	// Archives that cannot be read are the uploader's problem, not the server's. Limits
+	// only stop the reading, keeping the files read until then
+	switch {
+	case errors.Is(err, errBadArchive):
+		v.AddFieldError("upload", "The archive is damaged or is not a zip or tar.gz archive")
+		return nil, nil
+	case errors.Is(err, errArchiveTooLarge):
+		v.AddFieldError("upload", fmt.Sprintf("The archive holds more than %s once extracted, so only some of its files can be imported", humanSize(MaxImportExpandedSize)))
+	case errors.Is(err, errImportLimit):
+		// add already told which limit was reached
+	case err != nil:
+		return nil, err
+	}
+
+	if len(imp.entries) == 0 && v.Valid() {
+		v.AddFieldError("upload", "The upload has no files to import")
+	}
+
+	return imp.entries, nil
+}
+
+/*	errBadArchive wraps the errors of archives that cannot be read	*/
+var errBadArchive = errors.New("bad archive")
+
+/*	errImportLimit stops the reading of an upload once it reached one of the import
+	limits, since nothing else of it would be imported	*/
+var errImportLimit = errors.New("import limit reached")
+
+/*	errArchiveTooLarge is the errImportLimit of archives that decompress into more than
+	MaxImportExpandedSize bytes	*/
+var errArchiveTooLarge = fmt.Errorf("%w: archive too large once extracted", errImportLimit)
+
+/*	archiveError wraps an error met while reading an archive in errBadArchive, unless
+	it comes from the import limits, which are not the archive's fault	*/
+func archiveError(err error) error {
+	if errors.Is(err, errImportLimit) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", errBadArchive, err)
+}
+
+/*	expansionLimiter reads decompressed data, failing with errArchiveTooLarge once more
+	than `left` bytes have been read	*/
+type expansionLimiter struct {
+	r		io.Reader
+	left	int64
+}
+
+func (l *expansionLimiter) Read(p []byte) (int, error) {
+	if l.left <= 0 {
+		return 0, errArchiveTooLarge
+	}
+
+	if int64(len(p)) > l.left {
+		p = p[:l.left]
+	}
+
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+
+	return n, err
+}
+
+/*	importer collects the files of an upload into entries, enforcing the limits on
+	their number and size	*/
+type importer struct {
+	v		*validator.Validator
+	entries	[]importEntry
+	total	int
+}
+
+/*	add reads a file of the upload into a new entry. Once a file goes past the limits,
+	it is left out and reported on the upload, and errImportLimit is returned so that
+	the rest of the upload is not read for nothing	*/
+func (imp *importer) add(filePath string, r io.Reader) error {
+	if len(imp.entries) == MaxImportFiles {
+		imp.v.AddFieldError("upload", fmt.Sprintf("Only the first %d files can be imported at once", MaxImportFiles))
+		return errImportLimit
+	}
+
+	// Read a byte past the limit to tell whether the file is too large, without ever
+	// reading more than that, however much the archive claims the file holds
+	b, err := io.ReadAll(io.LimitReader(r, MaxImportFileSize + 1))
+	if err != nil {
+		return err
+	}
+
+	if imp.total + len(b) > MaxImportSize {
+		imp.v.AddFieldError("upload", fmt.Sprintf("The files add up to more than %s, so only some of them can be imported", humanSize(MaxImportSize)))
+		return errImportLimit
+	}
+
+	imp.total += len(b)
+
+	// What was read of oversized files is left out of the form, which would have to
+	// send it back
+	var e importEntry
+	if len(b) > MaxImportFileSize {
+		e = newImportEntry(filePath, "")
+		e.AddFieldError("content", fmt.Sprintf("The file is larger than %s", humanSize(MaxImportFileSize)))
+	} else {
+		e = newImportEntry(filePath, string(b))
+		e.check()
+	}
+
+	// Only files without problems are imported unless the user says otherwise
+	e.Include = e.Valid()
+
+	imp.entries = append(imp.entries, e)
+
+	return nil
+}
+
+func (imp *importer) readZip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errBadArchive, err)
+	}
+
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() || skipImportPath(zf.Name) {
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return archiveError(err)
+		}
+
+		// Only the files that are imported get decompressed, so the limits on them
+		// also bound how much is
+		err = imp.add(path.Clean(zf.Name), rc)
+		rc.Close()
+		if err != nil {
+			return archiveError(err)
+		}
+	}
+
+	return nil
+}
+
+func (imp *importer) readTarGz(r io.Reader) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errBadArchive, err)
+	}
+
+	defer zr.Close()
+
+	// Skipping a file of a tar.gz archive still decompresses it, so whatever is read
+	// from the archive counts
+	tr := tar.NewReader(&expansionLimiter{r: zr, left: MaxImportExpandedSize})
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return archiveError(err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg || skipImportPath(hdr.Name) {
+			continue
+		}
+
+		err = imp.add(path.Clean(hdr.Name), tr)
+		if err != nil {
+			return archiveError(err)
+		}
+	}
+}
+
+/*	skipImportPath reports whether a file of an archive is left out of the import.
+	Hidden files and folders, such as .git, and the metadata macOS adds to archives
+	are not snippets anyone meant to import	*/
+func skipImportPath(name string) bool {
+	for _, part := range strings.Split(path.Clean(strings.TrimPrefix(name, "./")), "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+
+	return false
+}
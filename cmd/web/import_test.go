@@ -0,0 +1,330 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"mime/multipart"
+	"reflect"
+	"strings"
+	"testing"
+
+	"snippetbox.octaviorassi.net/internal/validator"
+)
+
+/*	archiveFile is a file put in the archives built by the tests	*/
+type archiveFile struct {
+	name	string
+	content	string
+}
+
+func zipArchive(t *testing.T, files ...archiveFile) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f.content))
+	}
+
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+/*	tarGzArchive builds a tar.gz archive of `files`, followed by `trailer` written as it
+	is into the compressed stream	*/
+func tarGzArchive(t *testing.T, trailer string, files ...archiveFile) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(f.name, "/") {
+			hdr = &tar.Header{Name: f.name, Mode: 0755, Typeflag: tar.TypeDir}
+		}
+
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(f.content))
+	}
+
+	if trailer != "" {
+		tw.Flush()
+		gz.Write([]byte(trailer))
+	} else {
+		tw.Close()
+	}
+
+	err := gz.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+/*	uploadFile returns the header of `data` uploaded as a file named `name`	*/
+func uploadFile(t *testing.T, name string, data []byte) *multipart.FileHeader {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	fw, err := mw.CreateFormFile("upload", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	mw.Close()
+
+	form, err := multipart.NewReader(&body, mw.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+
+	return form.File["upload"][0]
+}
+
+/*	paths returns the paths of `entries`, marking those left out of the import with
+	a leading '!'	*/
+func paths(entries []importEntry) []string {
+	var paths []string
+
+	for _, e := range entries {
+		if e.Include {
+			paths = append(paths, e.Path)
+		} else {
+			paths = append(paths, "!"+e.Path)
+		}
+	}
+
+	return paths
+}
+
+func TestReadImport(t *testing.T) {
+	tests := []struct {
+		name		string
+		filename	string
+		data		[]byte
+		want		[]string
+		uploadError	string
+	}{
+		{
+			"single file",
+			"notes.txt",
+			[]byte("hello\n"),
+			[]string{"notes.txt"},
+			"",
+		},
+		{
+			"zip",
+			"snippets.zip",
+			zipArchive(t,
+				archiveFile{"src/main.go", "package main\n"},
+				archiveFile{"README.md", "# Title\n"},
+				archiveFile{"empty.txt", ""},
+				archiveFile{"binary.dat", "a\x00b"},
+				archiveFile{"src/", ""},
+			),
+			[]string{"src/main.go", "README.md", "!empty.txt", "!binary.dat"},
+			"",
+		},
+		{
+			"zip with hidden files",
+			"snippets.zip",
+			zipArchive(t,
+				archiveFile{".env", "SECRET=1"},
+				archiveFile{".git/config", "[core]"},
+				archiveFile{"__MACOSX/._main.go", "x"},
+				archiveFile{"main.go", "package main\n"},
+			),
+			[]string{"main.go"},
+			"",
+		},
+		{
+			"tar.gz",
+			"snippets.tar.gz",
+			tarGzArchive(t, "",
+				archiveFile{"./project/", ""},
+				archiveFile{"./project/a.rs", "fn main() {}\n"},
+				archiveFile{"./project/.hidden/b.sql", "SELECT 1;\n"},
+				archiveFile{"query.sql", "SELECT 2;\n"},
+			),
+			[]string{"project/a.rs", "query.sql"},
+			"",
+		},
+		{
+			"damaged zip",
+			"snippets.zip",
+			[]byte("PK\x03\x04 not really a zip"),
+			nil,
+			"The archive is damaged or is not a zip or tar.gz archive",
+		},
+		{
+			"damaged tar.gz",
+			"snippets.tar.gz",
+			tarGzArchive(t, "not a tar header", archiveFile{"a.txt", "a"}),
+			nil,
+			"The archive is damaged or is not a zip or tar.gz archive",
+		},
+		{
+			"only hidden files",
+			"snippets.zip",
+			zipArchive(t, archiveFile{".env", "SECRET=1"}),
+			nil,
+			"The upload has no files to import",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v validator.Validator
+
+			entries, err := readImport(&v, uploadFile(t, tt.filename, tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := paths(entries); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("paths = %q, want %q", got, tt.want)
+			}
+			if got := v.FieldErrors["upload"]; got != tt.uploadError {
+				t.Errorf("upload error = %q, want %q", got, tt.uploadError)
+			}
+		})
+	}
+}
+
+func TestReadImportLimits(t *testing.T) {
+	// Files of the largest size allowed, of which only so many fit in an import
+	var large []archiveFile
+	for i := range MaxImportSize/MaxImportFileSize + 2 {
+		large = append(large, archiveFile{fmt.Sprintf("%d.txt", i), strings.Repeat("a", MaxImportFileSize)})
+	}
+
+	var many []archiveFile
+	for i := range MaxImportFiles + 1 {
+		many = append(many, archiveFile{fmt.Sprintf("%d.txt", i), "a"})
+	}
+
+	tests := []struct {
+		name		string
+		filename	string
+		data		[]byte
+		entries		int
+		uploadError	string
+	}{
+		{
+			"too many files",
+			"snippets.zip",
+			zipArchive(t, many...),
+			MaxImportFiles,
+			fmt.Sprintf("Only the first %d files can be imported at once", MaxImportFiles),
+		},
+		{
+			// Reading stops at the limit, so the damaged end of the archive is not reached
+			"too many files in a damaged tar.gz",
+			"snippets.tar.gz",
+			tarGzArchive(t, "not a tar header", many...),
+			MaxImportFiles,
+			fmt.Sprintf("Only the first %d files can be imported at once", MaxImportFiles),
+		},
+		{
+			"too large in total",
+			"snippets.zip",
+			zipArchive(t, large...),
+			MaxImportSize / MaxImportFileSize,
+			"The files add up to more than 4.0 MB, so only some of them can be imported",
+		},
+		{
+			// Hidden files are not imported, but still have to be decompressed to skip
+			// them
+			"too large once extracted",
+			"snippets.tar.gz",
+			tarGzArchive(t, "",
+				archiveFile{"a.txt", "a"},
+				archiveFile{".hidden", strings.Repeat("\x00", MaxImportExpandedSize)},
+				archiveFile{"b.txt", "b"},
+			),
+			1,
+			"The archive holds more than 16.0 MB once extracted, so only some of its files can be imported",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v validator.Validator
+
+			entries, err := readImport(&v, uploadFile(t, tt.filename, tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(entries) != tt.entries {
+				t.Errorf("got %d entries, want %d", len(entries), tt.entries)
+			}
+			if got := v.FieldErrors["upload"]; got != tt.uploadError {
+				t.Errorf("upload error = %q, want %q", got, tt.uploadError)
+			}
+		})
+	}
+}
+
+func TestReadImportLargeFile(t *testing.T) {
+	var v validator.Validator
+
+	data := zipArchive(t,
+		archiveFile{"large.txt", strings.Repeat("a", MaxImportFileSize+1)},
+		archiveFile{"small.txt", "a"},
+	)
+
+	entries, err := readImport(&v, uploadFile(t, "snippets.zip", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Oversized files are listed, without their content, but left out of the import
+	if got, want := paths(entries), []string{"!large.txt", "small.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("paths = %q, want %q", got, want)
+	}
+	if entries[0].Content != "" || entries[0].FieldErrors["content"] == "" {
+		t.Errorf("oversized entry has %d bytes of content and error %q", len(entries[0].Content), entries[0].FieldErrors["content"])
+	}
+	if !v.Valid() {
+		t.Errorf("upload errors: %v", v.FieldErrors)
+	}
+}
+
+func TestSkipImportPath(t *testing.T) {
+	tests := []struct {
+		name	string
+		skip	bool
+	}{
+		{"main.go", false},
+		{"./src/main.go", false},
+		{"src/lib/util.go", false},
+		{".env", true},
+		{"./.env", true},
+		{".git/config", true},
+		{"src/.cache/file", true},
+		{"__MACOSX/._main.go", true},
+		{"project/__MACOSX/file", true},
+	}
+
+	for _, tt := range tests {
+		if got := skipImportPath(tt.name); got != tt.skip {
+			t.Errorf("skipImportPath(%q) = %v, want %v", tt.name, got, tt.skip)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+/*	attemptLimiter counts failed attempts per key, such as wrong passwords entered for a
+	given snippet, and blocks a key once it has failed `max` times within `window`. It
+	is safe for concurrent use	*/
+type attemptLimiter struct {
+	mu			sync.Mutex
+	max			int
+	window		time.Duration
+	failures	map[string][]time.Time
+	lastSweep	time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:		max,
+		window:		window,
+		failures:	make(map[string][]time.Time),
+		lastSweep:	time.Now(),
+	}
+}
+
+/*	Allow reserves an attempt for `key`, returning true along with the time it was
+	reserved at, unless the key already used up its attempts. Reserved attempts count
+	as failed until they are handed back to Succeed, so that many concurrent attempts
+	cannot all get through before the first of them fails. When the key is blocked,
+	it also returns how long until it can try again	*/
+func (l *attemptLimiter) Allow(key string) (bool, time.Time, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	failures := l.recent(key, now)
+	if len(failures) >= l.max {
+		// The key is allowed again once its oldest recent failure falls out of the window
+		return false, time.Time{}, failures[0].Add(l.window).Sub(now)
+	}
+
+	l.failures[key] = append(failures, now)
+
+	// Forget the keys that have not failed lately, so that the map does not keep growing
+	if now.Sub(l.lastSweep) > l.window {
+		for k := range l.failures {
+			l.recent(k, now)
+		}
+		l.lastSweep = now
+	}
+
+	return true, now, 0
+}
+
+/*	Succeed releases the attempt reserved for `key` at `at`, which turned out not to
+	be a failure	*/
+func (l *attemptLimiter) Succeed(key string, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	failures := l.failures[key]
+
+	for i, t := range failures {
+		if t.Equal(at) {
+			l.failures[key] = slices.Delete(failures, i, i+1)
+			break
+		}
+	}
+
+	l.recent(key, time.Now())
+}
+
+/*	recent drops the failures of `key` that are older than the window, forgetting the
+	key if none remain, and returns the others, oldest first. The caller must hold the
+	lock	*/
+func (l *attemptLimiter) recent(key string, now time.Time) []time.Time {
+	failures := l.failures[key]
+
+	i := 0
+	for i < len(failures) && now.Sub(failures[i]) >= l.window {
+		i++
+	}
+
+	failures = failures[i:]
+	if len(failures) == 0 {
+		delete(l.failures, key)
+	} else {
+		l.failures[key] = failures
+	}
+
+	return failures
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+/*	age moves every attempt recorded for `key` back by `d`	*/
+func age(l *attemptLimiter, key string, d time.Duration) {
+	for i := range l.failures[key] {
+		l.failures[key][i] = l.failures[key][i].Add(-d)
+	}
+}
+
+func TestAttemptLimiter(t *testing.T) {
+	l := newAttemptLimiter(3, time.Minute)
+
+	for i := range 3 {
+		if ok, _, _ := l.Allow("a"); !ok {
+			t.Fatalf("attempt %d was not allowed", i+1)
+		}
+	}
+
+	ok, _, wait := l.Allow("a")
+	if ok {
+		t.Fatal("attempt after 3 failures was allowed")
+	}
+	if wait <= 0 || wait > time.Minute {
+		t.Errorf("wait = %v, want within the window", wait)
+	}
+
+	// Other keys have attempts of their own
+	if ok, _, _ := l.Allow("b"); !ok {
+		t.Error("another key was blocked")
+	}
+
+	// Once the failures fall out of the window, the key is allowed again
+	age(l, "a", time.Minute)
+
+	if ok, _, _ := l.Allow("a"); !ok {
+		t.Error("attempt after the window was not allowed")
+	}
+	if len(l.failures["a"]) != 1 {
+		t.Errorf("key has %d attempts, want 1", len(l.failures["a"]))
+	}
+}
+
+func TestAttemptLimiterSucceed(t *testing.T) {
+	l := newAttemptLimiter(2, time.Minute)
+
+	_, first, _ := l.Allow("a")
+	l.Allow("a")
+
+	// A successful attempt is handed back and does not count against the key
+	l.Succeed("a", first)
+
+	if ok, _, _ := l.Allow("a"); !ok {
+		t.Error("attempt after a success was not allowed")
+	}
+	if ok, _, _ := l.Allow("a"); ok {
+		t.Error("third attempt was allowed")
+	}
+
+	// Handing back every attempt forgets the key
+	l = newAttemptLimiter(2, time.Minute)
+	_, at, _ := l.Allow("b")
+	l.Succeed("b", at)
+
+	if _, ok := l.failures["b"]; ok {
+		t.Error("key with no attempts left was kept")
+	}
+}
+
+func TestAttemptLimiterConcurrent(t *testing.T) {
+	l := newAttemptLimiter(5, time.Minute)
+
+	var (
+		wg		sync.WaitGroup
+		mu		sync.Mutex
+		allowed	int
+	)
+
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if ok, _, _ := l.Allow("a"); ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if allowed != 5 {
+		t.Errorf("%d concurrent attempts were allowed, want 5", allowed)
+	}
+}
+
+func TestAttemptLimiterSweep(t *testing.T) {
+	l := newAttemptLimiter(3, time.Minute)
+
+	l.Allow("a")
+	age(l, "a", time.Minute)
+	l.lastSweep = l.lastSweep.Add(-2 * time.Minute)
+
+	// An attempt after the sweep interval forgets the keys that have not failed lately
+	l.Allow("b")
+
+	if _, ok := l.failures["a"]; ok {
+		t.Error("stale key was not swept")
+	}
+	if len(l.failures["b"]) != 1 {
+		t.Errorf("recent key has %d attempts, want 1", len(l.failures["b"]))
+	}
+}
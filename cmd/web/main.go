@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
 	"flag"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/mysqlstore"
@@ -14,6 +18,8 @@ import (
 	"github.com/go-playground/form/v4"
 	_ "github.com/go-sql-driver/mysql"
 
+	"snippetbox.octaviorassi.net/internal/blob"
+	"snippetbox.octaviorassi.net/internal/highlight"
 	"snippetbox.octaviorassi.net/internal/models"
 )
 
@@ -21,21 +27,53 @@ type application struct {
 	logger 			*slog.Logger
 	snippets 		*models.SnippetModel
 	users 			*models.UserModel
+	tags 			*models.TagModel
+	comments		*models.CommentModel
+	annotations		*models.AnnotationModel
+	attachments		*models.AttachmentModel
+	// Where the data of attachments is kept
+	blobs			blob.Store
+	stars			*models.StarModel
 	templateCache 	templateCache
+	renders			*highlight.Cache
 	formDecoder		*form.Decoder
 	sessionManager  *scs.SessionManager
+	trashWindow		time.Duration
+	pageSize		int
+	unlockLimiter	*attemptLimiter
+	reapBatch		int
 }
 
+// How long in-flight requests are given to complete when the server shuts down
+const ShutdownTimeout = 30 * time.Second
+
 func main() {
 	// Define and parse the execution flags
 	addr := flag.String("addr", ":4000", "HTTP network address")
 	dsn	 := flag.String("dsn", "web:pass@/snippetbox?parseTime=true", "MySQL data source name")
+	pageSize := flag.Int("page-size", 10, "Default number of snippets listed per page")
+	trashWindow := flag.Duration("trash-window", 30 * 24 * time.Hour, "How long deleted snippets can be restored before being purged")
+	reapInterval := flag.Duration("reap-interval", time.Hour, "How often expired and trashed snippets are purged")
+	reapBatch := flag.Int("reap-batch", 1000, "How many snippets are purged per DELETE statement")
+	blobDir := flag.String("blob-dir", "./data/blobs", "Directory where attachments are stored")
+	inlineLimit := flag.Int("inline-limit", 64 << 10, "Largest compressed snippet body, in bytes, kept in the database rather than in the content store")
+	contentDir := flag.String("content-dir", "./data/content", "Directory where large snippet bodies are stored, unless -s3-endpoint is set")
+	s3Endpoint := flag.String("s3-endpoint", "", "URL of an S3-compatible service to store large snippet bodies in, such as http://localhost:9000")
+	s3Region := flag.String("s3-region", "us-east-1", "Region of the S3 bucket")
+	s3Bucket := flag.String("s3-bucket", "snippetbox", "S3 bucket where large snippet bodies are stored")
+	renderCache := flag.Int("render-cache", 64 << 20, "How many bytes of rendered snippets are kept in memory")
 
 	flag.Parse()
 	
 	// Create the app's logger
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{ AddSource: true,}))
 
+	// A batch size below one would never let the reaper make progress
+	if *reapBatch < 1 {
+		logger.Error("reap-batch must be at least 1")
+		os.Exit(1)
+	}
+
 	// Create the DB connection pool
 	db, err := openDB(*dsn)
 	if err != nil {
@@ -59,18 +97,73 @@ func main() {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
-	// Defer the closure of all the prepared statements
-	defer snippetModel.InsertStmt.Close()
-	defer snippetModel.GetStmt.Close()
-	defer snippetModel.LatestStmt.Close()
 
-	// Start the template cache
-	templateCache, err := newTemplateCache()
+	// And the tagModel as well
+	tagModel, err := models.NewTagModel(db)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// And the commentModel
+	commentModel, err := models.NewCommentModel(db)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// And the starModel
+	starModel, err := models.NewStarModel(db)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// And the annotationModel
+	annotationModel, err := models.NewAnnotationModel(db)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// And the attachmentModel, whose data goes to the blob store
+	attachmentModel, err := models.NewAttachmentModel(db)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	blobStore, err := blob.NewFileStore(*blobDir)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
 
+	// Large snippet bodies go to a store of their own. The S3 credentials are read from
+	// the environment so that they do not show up in the process list
+	var contentStore blob.Store
+	if *s3Endpoint != "" {
+		contentStore, err = blob.NewS3Store(*s3Endpoint, *s3Region, *s3Bucket,
+											os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	} else {
+		contentStore, err = blob.NewFileStore(*contentDir)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	snippetModel.Store = contentStore
+	snippetModel.InlineLimit = *inlineLimit
+
+	// Defer the closure of all the prepared statements
+	defer snippetModel.InsertStmt.Close()
+	defer snippetModel.GetStmt.Close()
+	defer snippetModel.GetPublicStmt.Close()
+	defer snippetModel.OlderStmt.Close()
+	defer snippetModel.NewerStmt.Close()
+	defer snippetModel.ByUserStmt.Close()
+
 	// Initialize a decoder instance
 	formDecoder := form.NewDecoder()
 
@@ -84,11 +177,67 @@ func main() {
 		logger:	  		logger,
 		snippets: 		snippetModel,
 		users:			userModel,
-		templateCache: 	templateCache,
+		tags:			tagModel,
+		comments:		commentModel,
+		annotations:	annotationModel,
+		attachments:	attachmentModel,
+		blobs:			blobStore,
+		stars:			starModel,
+		renders:		highlight.NewCache(*renderCache),
 		formDecoder: 	formDecoder,
 		sessionManager: sessionManager,
+		trashWindow:	*trashWindow,
+		pageSize:		*pageSize,
+		unlockLimiter:	newAttemptLimiter(MaxUnlockAttempts, UnlockWindow),
+		reapBatch:		*reapBatch,
 	}
 
+	// `web reap` purges dead snippets once and exits, so it can be scheduled with cron
+	// instead of, or on top of, the server's own reaper
+	switch flag.Arg(0) {
+	case "":
+	case "reap":
+		err = app.reap(context.Background())
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	case "migrate-content":
+		// Converts the bodies stored before they were hashed and compressed. It only
+		// needs to run once, but can be resumed if it is interrupted
+		report, err := app.snippets.MigrateContent(*reapBatch)
+		logger.Info("migrated snippet contents", slog.Int("rows", report.Rows),
+					slog.String("before", humanSize(report.Before)), slog.String("after", humanSize(report.After)),
+					slog.String("saved", humanSize(report.Saved())))
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	default:
+		logger.Error("unknown command", "command", flag.Arg(0))
+		os.Exit(1)
+	}
+
+	// Start the template cache, which is only needed to serve requests
+	app.templateCache, err = newTemplateCache()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Shut down gracefully on Ctrl+C, or when the process manager asks to
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Permanently remove expired snippets and those that have been in the trash for too long
+	var reaper sync.WaitGroup
+	reaper.Add(1)
+	go func() {
+		defer reaper.Done()
+		app.runReaper(ctx, *reapInterval)
+	}()
 
 	mux := app.routes()
 
@@ -112,10 +261,33 @@ func main() {
 	
 	logger.Info("Starting server", "addr", *addr)
 
-	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
+	}()
+
+	select {
+	case err = <-serveErr:
+		logger.Error(err.Error())
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down server")
+
+	// Stop accepting connections and wait for the in-flight requests, and for the reaper
+	// to finish its current batch, before the deferred calls close the database
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	err = srv.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+
+	reaper.Wait()
 
-	logger.Error(err.Error())
-	os.Exit(1)
+	logger.Info("Server stopped")
 }
 
 func openDB(dsn string) (*sql.DB, error) {
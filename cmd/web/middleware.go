@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/justinas/nosurf"
 )
@@ -69,6 +71,42 @@ func noSurf(next http.Handler) http.Handler {
 	return csrfHandler
 }
 
+/*	limitBody caps the request body at `max` bytes, answering 413 Request Entity Too
+	Large beyond it, and parses the form right away. noSurf reads the whole form while
+	looking for the CSRF token, with no limit of its own, so this must come before it.
+	Since large uploads take a while to send, the request is also given UploadTimeout
+	to be read and answered, rather than the server's usual timeouts	*/
+func (app *application) limitBody(max int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					deadline := time.Now().Add(UploadTimeout)
+
+					rc := http.NewResponseController(w)
+					err := errors.Join(rc.SetReadDeadline(deadline), rc.SetWriteDeadline(deadline))
+					if err != nil {
+						app.serverError(w, r, err)
+						return
+					}
+
+					r.Body = http.MaxBytesReader(w, r.Body, max)
+
+					err = parseForm(r)
+					if err != nil {
+						var maxBytesError *http.MaxBytesError
+						if errors.As(err, &maxBytesError) {
+							app.clientError(w, http.StatusRequestEntityTooLarge)
+						} else {
+							app.clientError(w, http.StatusBadRequest)
+						}
+						return
+					}
+
+					next.ServeHTTP(w, r)
+				})
+	}
+}
+
 /*	requireAuthentication adds an authentication check to the given handler. If it passes, the
 	next handler executes. Otherwise, the user is redirected to the login page instead.	*/
 func (app *application) requireAuthentication(next http.Handler) http.Handler {
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"snippetbox.octaviorassi.net/internal/highlight"
+	"snippetbox.octaviorassi.net/internal/models"
+)
+
+// The longest file name derived from a snippet's title, extension excluded
+const MaxFilenameLength = 50
+
+/*	rawSnippet fetches the snippet reachable by the request's id wildcard for the raw
+	endpoints, applying the same rules as snippetView. Since these endpoints are meant
+	for tools like curl, a snippet that would need an extra step on its page, because
+	it is password protected or has limited views, is refused rather than redirected.
+	If anything fails, the error response is written and the second return value is
+	false	*/
+func (app *application) rawSnippet(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	publicID, ok := pathPublicID(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return models.Snippet{}, false
+	}
+
+	snippet, ok := app.viewableSnippet(w, r, publicID)
+	if !ok {
+		return models.Snippet{}, false
+	}
+
+	if !app.isUnlocked(r, snippet) || (snippet.ViewsLeft > 0 && !app.ownsSnippet(r, snippet)) {
+		app.clientError(w, http.StatusForbidden)
+		return models.Snippet{}, false
+	}
+
+	app.setNoIndex(w, snippet)
+
+	return snippet, true
+}
+
+/*	writeRaw writes the exact content of a snippet, or of one of its files, as plain
+	text. Bodies kept in the content store under `key` are streamed from it rather
+	than read whole first	*/
+func (app *application) writeRaw(w http.ResponseWriter, r *http.Request, content, key string) {
+	body, err := app.snippets.OpenContent(content, key)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	defer body.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent, so a failure can only cut the response short
+	_, err = io.Copy(w, body)
+	if err != nil {
+		app.logger.Error(err.Error(), slog.Any("method", r.Method), slog.Any("uri", r.URL.RequestURI()))
+	}
+}
+
+/*	snippetFilename derives a file name from the snippet's title and language, such as
+	"my-snippet.go". Titles without any letter or digit fall back to the public id.
+	The language is detected from the same part of the body the snippet's page shows,
+	since bodies in the content store are not loaded yet	*/
+func (app *application) snippetFilename(snippet models.Snippet) (string, error) {
+	// Keep ASCII letters and digits only, so the name is safe on every file system
+	// and in the Content-Disposition header, and join the words with dashes
+	words := strings.FieldsFunc(strings.ToLower(snippet.Title), func(r rune) bool {
+		return r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+
+	name := strings.Join(words, "-")
+	if len(name) > MaxFilenameLength {
+		name = strings.TrimRight(name[:MaxFilenameLength], "-")
+	}
+	if name == "" {
+		name = "snippet-" + snippet.PublicID
+	}
+
+	language := snippet.Language
+	if language == highlight.Auto {
+		content, _, err := app.shownContent(snippet)
+		if err != nil {
+			return "", err
+		}
+
+		language = highlight.Detect(content)
+	}
+
+	return name + highlight.Extension(language), nil
+}
+
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.rawSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeRaw(w, r, snippet.Content, snippet.ContentKey)
+}
+
+func (app *application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.rawSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := app.snippetFiles(snippet)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The main file keeps its own name, if it was given one
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": files[0].Name}))
+	app.writeRaw(w, r, snippet.Content, snippet.ContentKey)
+}
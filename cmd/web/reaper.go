@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+/*	runReaper purges dead snippets once right away and then every `interval`, until
+	`ctx` is cancelled. It is meant to be run on its own goroutine	*/
+func (app *application) runReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := app.reap(ctx)
+		if err != nil && ctx.Err() == nil {
+			app.logger.Error(err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+/*	reap permanently deletes the snippets that have expired and those whose restore
+	window has passed, in batches of app.reapBatch, and then the contents and
+	attachments they leave behind. It stops between batches once `ctx` is cancelled	*/
+func (app *application) reap(ctx context.Context) error {
+	expired, err := app.purge(ctx, app.snippets.PurgeExpired)
+	if expired > 0 {
+		app.logger.Info("purged expired snippets", slog.Int64("count", expired))
+	}
+	if err != nil {
+		return err
+	}
+
+	trashed, err := app.purge(ctx, func(limit int) (int64, error) {
+		return app.snippets.PurgeTrash(app.trashWindow, limit)
+	})
+	if trashed > 0 {
+		app.logger.Info("purged snippets from trash", slog.Int64("count", trashed))
+	}
+	if err != nil {
+		return err
+	}
+
+	unreferenced, err := app.purge(ctx, app.snippets.PurgeContents)
+	if unreferenced > 0 {
+		app.logger.Info("purged unreferenced snippet contents", slog.Int64("count", unreferenced))
+	}
+	if err != nil {
+		return err
+	}
+
+	orphaned, err := app.purge(ctx, app.purgeOrphanedAttachments)
+	if orphaned > 0 {
+		app.logger.Info("purged orphaned attachments", slog.Int64("count", orphaned))
+	}
+
+	return err
+}
+
+/*	purge calls `batch` until it deletes less than a full batch, returning how many
+	rows were deleted in total	*/
+func (app *application) purge(ctx context.Context, batch func(limit int) (int64, error)) (int64, error) {
+	var total int64
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		n, err := batch(app.reapBatch)
+		total += n
+		if err != nil {
+			return total, err
+		}
+
+		if n < int64(app.reapBatch) {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+/*	batches returns a batch function that deletes the given number of rows on each
+	successive call, along with a pointer to how many times it was called	*/
+func batches(counts ...int64) (func(limit int) (int64, error), *int) {
+	calls := 0
+
+	return func(limit int) (int64, error) {
+		n := counts[calls]
+		calls++
+		return n, nil
+	}, &calls
+}
+
+func TestPurge(t *testing.T) {
+	tests := []struct {
+		name	string
+		counts	[]int64
+		total	int64
+	}{
+		{"nothing to purge", []int64{0}, 0},
+		{"single short batch", []int64{2}, 2},
+		{"several batches", []int64{3, 3, 1}, 7},
+		{"last batch exactly full", []int64{3, 3, 0}, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{reapBatch: 3}
+			batch, calls := batches(tt.counts...)
+
+			total, err := app.purge(context.Background(), batch)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if total != tt.total || *calls != len(tt.counts) {
+				t.Errorf("purged %d rows in %d calls, want %d in %d", total, *calls, tt.total, len(tt.counts))
+			}
+		})
+	}
+}
+
+func TestPurgeError(t *testing.T) {
+	app := &application{reapBatch: 3}
+	fail := errors.New("lock wait timeout")
+
+	calls := 0
+	total, err := app.purge(context.Background(), func(limit int) (int64, error) {
+		calls++
+		if calls == 2 {
+			return 1, fail
+		}
+		return 3, nil
+	})
+
+	// The rows deleted before the error are still counted
+	if err != fail || total != 4 || calls != 2 {
+		t.Errorf("purge = %d, %v after %d calls, want 4, %v after 2", total, err, calls, fail)
+	}
+}
+
+func TestPurgeCancelled(t *testing.T) {
+	app := &application{reapBatch: 3}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	total, err := app.purge(ctx, func(limit int) (int64, error) {
+		calls++
+		// Shutting down in the middle of a batch lets it finish, but no other starts
+		cancel()
+		return 3, nil
+	})
+
+	if !errors.Is(err, context.Canceled) || total != 3 || calls != 1 {
+		t.Errorf("purge = %d, %v after %d calls, want 3, %v after 1", total, err, calls, context.Canceled)
+	}
+}
@@ -20,18 +20,67 @@ func (app *application) routes() http.Handler {
 
 	// Unprotected routes, only apply dynamic
 	mux.Handle("GET /{$}", 				 dynamic.ThenFunc(app.home))
+	mux.Handle("GET /snippets", 		 dynamic.ThenFunc(app.snippetArchive))
+	mux.Handle("GET /search", 			 dynamic.ThenFunc(app.searchSnippets))
+	mux.Handle("GET /tag/{name}", 		 dynamic.ThenFunc(app.tagView))
 	mux.Handle("GET /user/signup", 		 dynamic.ThenFunc(app.userSignup))
 	mux.Handle("POST /user/signup", 	 dynamic.ThenFunc(app.userSignupPost))
 	mux.Handle("GET /user/login", 		 dynamic.ThenFunc(app.userLogIn))
 	mux.Handle("POST /user/login", 		 dynamic.ThenFunc(app.userLogInPost))
 	mux.Handle("GET /snippet/view/{id}", dynamic.ThenFunc(app.snippetView))
+	mux.Handle("POST /snippet/view/{id}/unlock", 		   dynamic.ThenFunc(app.snippetUnlockPost))
+	mux.Handle("POST /snippet/view/{id}/reveal", 		   dynamic.ThenFunc(app.snippetRevealPost))
+	mux.Handle("GET /snippet/view/{id}/history", 		   dynamic.ThenFunc(app.snippetHistory))
+	mux.Handle("GET /snippet/view/{id}/history/{version}", dynamic.ThenFunc(app.snippetRevision))
+	mux.Handle("GET /snippet/view/{id}/diff", 			   dynamic.ThenFunc(app.revisionDiff))
+	mux.Handle("GET /snippet/diff", 	 dynamic.ThenFunc(app.snippetDiff))
+
+	mux.HandleFunc("GET /tags/suggest", app.tagSuggest)
+
+	// Raw routes are meant to be fetched by tools like curl, so they skip the CSRF
+	// handling. They still load the session, since private snippets are only served
+	// to their owner
+	raw := alice.New(app.sessionManager.LoadAndSave, app.authenticate)
+
+	mux.Handle("GET /snippet/view/{id}/diff/raw", raw.ThenFunc(app.revisionDiffRaw))
+	mux.Handle("GET /snippet/diff/raw", 		   raw.ThenFunc(app.snippetDiffRaw))
+	mux.Handle("GET /snippet/raw/{id}", 		   raw.ThenFunc(app.snippetRaw))
+	mux.Handle("GET /snippet/raw/{id}/{name}", 	   raw.ThenFunc(app.snippetRawFile))
+	mux.Handle("GET /snippet/attachment/{id}/{attachment}", raw.ThenFunc(app.snippetAttachment))
+	mux.Handle("GET /snippet/download/{id}", 	   raw.ThenFunc(app.snippetDownload))
 	
 	// Protected routes, apply dynamic & requireAuthentication
 	protected := dynamic.Append(app.requireAuthentication)
-	
-	mux.Handle("POST /snippet/create", 	 protected.ThenFunc(app.snippetCreatePost))
+
+	// Forms with uploads are limited in size before noSurf reads them, which only
+	// happens once the user is known to be logged in
+	loggedIn := alice.New(app.sessionManager.LoadAndSave, app.authenticate, app.requireAuthentication)
+	uploads := loggedIn.Append(app.limitBody(MaxUploadSize), noSurf)
+	imports := loggedIn.Append(app.limitBody(MaxImportUploadSize), noSurf)
+
+	mux.Handle("POST /snippet/create", 	 uploads.ThenFunc(app.snippetCreatePost))
 	mux.Handle("GET /snippet/create", 	 protected.ThenFunc(app.snippetCreate))
+	mux.Handle("GET /snippet/fork/{id}", protected.ThenFunc(app.snippetFork))
+	mux.Handle("GET /snippet/import",	 protected.ThenFunc(app.snippetImport))
+	mux.Handle("POST /snippet/import",	 imports.ThenFunc(app.snippetImportPost))
+	mux.Handle("POST /snippet/preview",	 uploads.ThenFunc(app.snippetPreview))
 	mux.Handle("POST /user/logout",		 protected.ThenFunc(app.userLogOutPost))
+	mux.Handle("GET /user/snippets",	 protected.ThenFunc(app.userSnippets))
+	mux.Handle("GET /user/stars",		 protected.ThenFunc(app.userStars))
+	mux.Handle("GET /snippet/edit/{id}", protected.ThenFunc(app.snippetEdit))
+	mux.Handle("POST /snippet/edit/{id}", protected.ThenFunc(app.snippetEditPost))
+	mux.Handle("GET /snippet/expiry/{id}", protected.ThenFunc(app.snippetExpiry))
+	mux.Handle("POST /snippet/expiry/{id}", protected.ThenFunc(app.snippetExpiryPost))
+	mux.Handle("POST /snippet/delete/{id}", protected.ThenFunc(app.snippetDeletePost))
+	mux.Handle("POST /snippet/restore/{id}", protected.ThenFunc(app.snippetRestorePost))
+	mux.Handle("POST /snippet/view/{id}/star", protected.ThenFunc(app.snippetStarPost))
+	mux.Handle("POST /snippet/view/{id}/comments", protected.ThenFunc(app.snippetCommentPost))
+	mux.Handle("POST /snippet/view/{id}/annotations", protected.ThenFunc(app.snippetAnnotatePost))
+	mux.Handle("POST /annotation/delete/{id}", protected.ThenFunc(app.annotationDeletePost))
+	mux.Handle("GET /comment/edit/{id}", protected.ThenFunc(app.commentEdit))
+	mux.Handle("POST /comment/edit/{id}", protected.ThenFunc(app.commentEditPost))
+	mux.Handle("POST /comment/delete/{id}", protected.ThenFunc(app.commentDeletePost))
+	mux.Handle("GET /user/trash",		 protected.ThenFunc(app.userTrash))
 	
 	return standard.Then(mux)
 }
\ No newline at end of file
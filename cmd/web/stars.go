@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+/*	snippetStarPost stars the snippet for the user, or unstars it if they had already
+	starred it, and sends them back to the snippet	*/
+func (app *application) snippetStarPost(w http.ResponseWriter, r *http.Request) {
+	publicID, ok := pathPublicID(r, "id")
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	// Starring does not reveal anything, so locked snippets can be starred as well
+	snippet, ok := app.viewableSnippet(w, r, publicID)
+	if !ok {
+		return
+	}
+
+	_, err := app.stars.Toggle(app.authenticatedUserID(r), snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", publicID), http.StatusSeeOther)
+}
+
+func (app *application) userStars(w http.ResponseWriter, r *http.Request) {
+
+	snippets, err := app.snippets.StarredBy(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.stars.SetCounts(snippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+
+	app.render(w, r, http.StatusOK, "stars.tmpl.html", data)
+}
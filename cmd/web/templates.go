@@ -1,26 +1,138 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	"path/filepath"
-	"text/template"
+	"strings"
+	"html/template"
 	"time"
 
 	"github.com/justinas/nosurf"
+	"snippetbox.octaviorassi.net/internal/diff"
+	"snippetbox.octaviorassi.net/internal/highlight"
 	"snippetbox.octaviorassi.net/internal/models"
+	"snippetbox.octaviorassi.net/internal/search"
 )
 
 
 type templateData struct {
 	Snippet	   		models.Snippet
 	Snippets 		[]models.Snippet
+	// The snippet the current one was forked from, if it can be linked to
+	Parent			models.Snippet
+	Forks			int
+	// Whether the authenticated user starred the snippet
+	Starred			bool
+	Comments		[]threadedComment
+	Comment			models.Comment
+	// The highlighted content of a snippet, split around its annotations
+	Blocks			[]codeBlock
+	// The annotations that could not be placed under a line
+	Annotations		[]models.Annotation
+	Rendered		renderedContent
+	// The files of a snippet, starting with its main one
+	Files			[]renderedFile
+	Attachments		[]models.Attachment
+	Preview			bool
+	NoIndex			bool
+	Revision		models.Revision
+	Revisions		[]models.Revision
+	Diff			diffData
+	TrashWindow		time.Duration
+	Pagination		pagination
+	Results			[]searchResult
+	Searched		bool
+	Tag				string
 	CurrentYear 	int
 	Form 			any
 	Flash			string
 	IsAuthenticated bool
+	AuthenticatedUserID int
 	CSRFToken		string
 }
 
+/*	renderedContent is a snippet's content ready to be embedded in a page. Markdown
+	documents are laid out as a page of their own rather than as code	*/
+type renderedContent struct {
+	HTML			template.HTML
+	Markdown		bool
+	// Set if only the start of the content is shown, because it is too large
+	Truncated		bool
+}
+
+/*	diffData holds a computed diff between two texts along with their labels	*/
+type diffData struct {
+	OldName			string
+	NewName			string
+	Hunks			[]diff.Hunk
+	RawURL			string
+}
+
+/*	pagination holds the links to the pages adjacent to the one being rendered. Empty
+	links are not rendered	*/
+type pagination struct {
+	PrevURL			string
+	NextURL			string
+}
+
+/*	newPagination builds the links to the pages adjacent to `page` on the listing at
+	`path`, keeping any extra query `params`	*/
+func newPagination(path string, page models.SnippetPage, params url.Values) pagination {
+	var p pagination
+
+	link := func(key, publicID string) string {
+		query := url.Values{}
+		for k, v := range params {
+			query[k] = v
+		}
+		query.Set(key, publicID)
+
+		return (&url.URL{Path: path, RawQuery: query.Encode()}).String()
+	}
+
+	if page.HasPrev {
+		p.PrevURL = link("before", page.Prev.Before)
+	}
+	if page.HasNext {
+		p.NextURL = link("after", page.Next.After)
+	}
+
+	return p
+}
+
+/*	threadedComment is a comment placed in the flattened list of a snippet's threads,
+	with how deeply it is nested	*/
+type threadedComment struct {
+	*models.Comment
+	Depth			int
+}
+
+// Replies nested deeper than this are shown at this depth
+const MaxCommentDepth = 5
+
+/*	flattenThreads lists the comments of `threads` in reading order, each reply right
+	after the comment it replies to	*/
+func flattenThreads(threads []*models.Comment, depth int) []threadedComment {
+	var list []threadedComment
+
+	for _, c := range threads {
+		list = append(list, threadedComment{Comment: c, Depth: min(depth, MaxCommentDepth)})
+		list = append(list, flattenThreads(c.Replies, depth+1)...)
+	}
+
+	return list
+}
+
+/*	searchResult is a snippet found by a search, with the matches in its title and
+	content excerpt split out so that they can be highlighted	*/
+type searchResult struct {
+	Snippet			models.Snippet
+	Title			[]search.Segment
+	Excerpt			[]search.Segment
+}
+
 type templateCache = map[string]*template.Template
 
 /*	newTemplateData returns an initialized templateData object with CurrentYear set
@@ -30,6 +142,7 @@ func (app *application) newTemplateData(r *http.Request) templateData {
 				CurrentYear: 	 time.Now().Year(),
 				Flash:		  	 app.sessionManager.PopString(r.Context(), "flash"),
 				IsAuthenticated: app.isAuthenticated(r),
+				AuthenticatedUserID: app.authenticatedUserID(r),
 				CSRFToken: 		 nosurf.Token(r),	
 			}
 }
@@ -78,5 +191,61 @@ func humanDate(t time.Time) string {
 	return t.Format("02 Jan 2006 at 15:04")
 }
 
+/*	humanExpiry formats when a snippet expires, which may be never	*/
+func humanExpiry(t *time.Time) string {
+	if t == nil {
+		return "Never"
+	}
+	return humanDate(*t)
+}
+
+/*	diffClass returns the CSS class used to highlight a diff line	*/
+func diffClass(op diff.Op) string {
+	switch op {
+	case diff.Insert:
+		return "added"
+	case diff.Delete:
+		return "removed"
+	default:
+		return "context"
+	}
+}
+
+/*	humanDuration formats a duration in whole days, or hours if it is shorter than a day */
+func humanDuration(d time.Duration) string {
+	if d < 24 * time.Hour {
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d days", int(d.Hours() / 24))
+}
+
+/*	humanSize formats a number of bytes in the largest unit that keeps it above one	*/
+func humanSize(n int64) string {
+	switch {
+	case n < 1 << 10:
+		return fmt.Sprintf("%d B", n)
+	case n < 1 << 20:
+		return fmt.Sprintf("%.1f KB", float64(n) / (1 << 10))
+	default:
+		return fmt.Sprintf("%.1f MB", float64(n) / (1 << 20))
+	}
+}
+
+/*	trimNewline removes the line terminator of a single line of text	*/
+func trimNewline(line string) string {
+	return strings.TrimRight(line, "\r\n")
+}
+
 /*	Define a global map that matches strings to our template functions	*/
-var functions = template.FuncMap{ "humanDate": humanDate, }
\ No newline at end of file
+var functions = template.FuncMap{
+	"humanDate": humanDate,
+	"humanExpiry": humanExpiry,
+	"humanDuration": humanDuration,
+	"humanSize": humanSize,
+	"isImage": isImage,
+	"diffClass": diffClass,
+	"trimNewline": trimNewline,
+	"languages": func() []*highlight.Language { return highlight.Languages },
+	"expiryPresets": func() []expiryPreset { return expiryPresets },
+	"annotationView": newAnnotationView,
+}
\ No newline at end of file
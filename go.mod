@@ -3,15 +3,20 @@ module snippetbox.octaviorassi.net
 go 1.23.3
 
 require (
+	github.com/alexedwards/scs/mysqlstore v0.0.0-20240316134038-7e11d57e8885
+	github.com/alexedwards/scs/v2 v2.8.0
+	github.com/go-playground/form/v4 v4.2.1
 	github.com/go-sql-driver/mysql v1.8.1
 	github.com/justinas/alice v1.2.0
+	github.com/justinas/nosurf v1.1.1
+	github.com/microcosm-cc/bluemonday v1.0.27
+	github.com/yuin/goldmark v1.7.8
+	golang.org/x/crypto v0.31.0
 )
 
 require (
 	filippo.io/edwards25519 v1.1.0 // indirect
-	github.com/alexedwards/scs/mysqlstore v0.0.0-20240316134038-7e11d57e8885 // indirect
-	github.com/alexedwards/scs/v2 v2.8.0 // indirect
-	github.com/go-playground/form/v4 v4.2.1 // indirect
-	github.com/justinas/nosurf v1.1.1 // indirect
-	golang.org/x/crypto v0.31.0 // indirect
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/gorilla/css v1.0.1 // indirect
+	golang.org/x/net v0.26.0 // indirect
 )
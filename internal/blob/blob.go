@@ -0,0 +1,36 @@
+package blob
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+/*	ErrNotFound is returned when a key has no blob stored under it	*/
+var ErrNotFound = errors.New("blob: not found")
+
+/*	Store keeps opaque blobs of data under string keys. Keys are chosen by the caller
+	and made of lowercase letters, digits and dashes only, so that every store can use
+	them as they are	*/
+type Store interface {
+	// Put stores everything read from `r` under `key`, replacing any previous blob
+	Put(key string, r io.Reader) error
+	// Get opens the blob stored under `key`, which the caller must close
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under `key`. Deleting a missing blob is not an
+	// error
+	Delete(key string) error
+}
+
+/*	NewKey returns a random key that will not collide with any other	*/
+func NewKey() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,86 @@
+package blob
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+/*	FileStore keeps blobs as files in a directory of the local file system, spread
+	over subdirectories named after the first characters of their keys	*/
+type FileStore struct {
+	Dir		string
+}
+
+/*	NewFileStore returns a store keeping its blobs under `dir`, which is created if it
+	does not exist yet	*/
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileStore{ Dir: dir }, nil
+}
+
+/*	path returns where the blob stored under `key` lives	*/
+func (s *FileStore) path(key string) string {
+	if len(key) < 2 {
+		return filepath.Join(s.Dir, key)
+	}
+	return filepath.Join(s.Dir, key[:2], key)
+}
+
+func (s *FileStore) Put(key string, r io.Reader) error {
+	path := s.path(key)
+
+	err := os.MkdirAll(filepath.Dir(path), 0o750)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that a failed upload never leaves a
+	// truncated blob behind
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileStore) Get(key string) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (s *FileStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
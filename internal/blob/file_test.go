@@ -0,0 +1,131 @@
+package blob
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "blobs")
+
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(key string) (string, error) {
+		r, err := s.Get(key)
+		if err != nil {
+			return "", err
+		}
+
+		defer r.Close()
+
+		b, err := io.ReadAll(r)
+		return string(b), err
+	}
+
+	tests := []struct {
+		name	string
+		key		string
+		body	string
+	}{
+		{"new blob", "0123abcd", "hello"},
+		{"replaced blob", "0123abcd", "hello, again"},
+		{"empty blob", "ffee", ""},
+		{"short key", "a", "tiny"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Put(tt.key, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := read(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.body {
+				t.Errorf("Get(%q) = %q, want %q", tt.key, got, tt.body)
+			}
+		})
+	}
+
+	// Blobs are spread over subdirectories named after the start of their keys
+	_, err = os.Stat(filepath.Join(dir, "01", "0123abcd"))
+	if err != nil {
+		t.Errorf("blob not stored under its subdirectory: %v", err)
+	}
+
+	// No temporary file is left behind
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "*", ".upload-*"))
+	if len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+
+	err = s.Delete("0123abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = read("0123abcd")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+
+	// Deleting a missing blob is not an error
+	err = s.Delete("0123abcd")
+	if err != nil {
+		t.Errorf("Delete of a missing blob: %v", err)
+	}
+}
+
+/*	failingReader fails after returning some data, like an interrupted upload	*/
+type failingReader struct {
+	sent	bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.sent {
+		return 0, errors.New("connection reset")
+	}
+
+	r.sent = true
+	return copy(p, "partial"), nil
+}
+
+func TestFileStoreFailedPut(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Put("abcd", strings.NewReader("complete"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed Put leaves the previous blob untouched
+	err = s.Put("abcd", &failingReader{})
+	if err == nil {
+		t.Fatal("Put from a failing reader succeeded")
+	}
+
+	r, err := s.Get("abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Close()
+
+	got, _ := io.ReadAll(r)
+	if string(got) != "complete" {
+		t.Errorf("Get after a failed Put = %q, want %q", got, "complete")
+	}
+}
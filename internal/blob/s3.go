@@ -0,0 +1,237 @@
+package blob
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+/*	S3Store keeps blobs as objects of a bucket on S3, or on any service speaking its
+	API such as MinIO. Buckets are addressed by path rather than by host name, which
+	every such service supports	*/
+type S3Store struct {
+	// The base URL of the service, such as "https://s3.eu-west-1.amazonaws.com" or
+	// "http://localhost:9000"
+	Endpoint	string
+	Region		string
+	Bucket		string
+	AccessKey	string
+	SecretKey	string
+	Client		*http.Client
+}
+
+/*	NewS3Store returns a store keeping its blobs in `bucket`, which must already exist	*/
+func NewS3Store(endpoint, region, bucket, accessKey, secretKey string) (*S3Store, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("blob: invalid S3 endpoint %q", endpoint)
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("blob: missing S3 bucket")
+	}
+
+	return &S3Store{
+		Endpoint:	strings.TrimSuffix(endpoint, "/"),
+		Region:		region,
+		Bucket:		bucket,
+		AccessKey:	accessKey,
+		SecretKey:	secretKey,
+		Client:		&http.Client{ Timeout: 5 * time.Minute },
+	}, nil
+}
+
+func (s *S3Store) Put(key string, r io.Reader) error {
+	// S3 needs to know the length of an object up front
+	body, size, cleanup, err := sized(r)
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	req, err := s.request(http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s.failure(req, resp)
+	}
+
+	return nil
+}
+
+func (s *S3Store) Get(key string) (io.ReadCloser, error) {
+	req, err := s.request(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	defer resp.Body.Close()
+
+	return nil, s.failure(req, resp)
+}
+
+func (s *S3Store) Delete(key string) error {
+	req, err := s.request(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	// Deleting a missing object succeeds on S3, but not on every stand-in
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s.failure(req, resp)
+	}
+
+	return nil
+}
+
+/*	request builds a signed request for the object stored under `key`	*/
+func (s *S3Store) request(method, key string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, s.Endpoint+"/"+url.PathEscape(s.Bucket)+"/"+url.PathEscape(key), body)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sign(req, time.Now().UTC())
+
+	return req, nil
+}
+
+/*	sign adds an AWS Signature Version 4 to the request. The payload is left unsigned,
+	so that it can be streamed rather than hashed beforehand	*/
+func (s *S3Store) sign(req *http.Request, now time.Time) {
+	const payload = "UNSIGNED-PAYLOAD"
+
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payload,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payload,
+	}, "\n")
+
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), day)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+											   s.AccessKey, scope, signedHeaders, signature))
+}
+
+/*	failure turns an unexpected response into an error, keeping the start of the error
+	document the service sent back	*/
+func (s *S3Store) failure(req *http.Request, resp *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	return fmt.Errorf("blob: S3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(detail)))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+/*	sized returns a reader over the same data as `r` along with its length. Readers
+	that cannot tell their length are first copied to a temporary file, which the
+	returned cleanup function removes	*/
+func sized(r io.Reader) (io.Reader, int64, func(), error) {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return r, int64(v.Len()), func() {}, nil
+	case io.Seeker:
+		start, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		end, err := v.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		_, err = v.Seek(start, io.SeekStart)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		return r, end - start, func() {}, nil
+	}
+
+	tmp, err := os.CreateTemp("", "blob-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+
+	size, err := io.Copy(tmp, r)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+
+	return tmp, size, cleanup, nil
+}
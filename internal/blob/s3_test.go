@@ -0,0 +1,227 @@
+package blob
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*	fakeS3 is a stand-in for an S3 service keeping objects in memory. Like the real
+	service, it rejects requests whose signature does not match the one computed with
+	its own copy of the credentials	*/
+type fakeS3 struct {
+	t			*testing.T
+	verifier	*S3Store
+	mu			sync.Mutex
+	objects		map[string][]byte
+}
+
+var authorizationRx = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=ak/(\d{8})/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=[0-9a-f]{64}$`)
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != "UNSIGNED-PAYLOAD" {
+		f.t.Errorf("X-Amz-Content-Sha256 = %q, want UNSIGNED-PAYLOAD", got)
+	}
+
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		f.t.Errorf("X-Amz-Date: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	m := authorizationRx.FindStringSubmatch(r.Header.Get("Authorization"))
+	if m == nil {
+		f.t.Errorf("malformed Authorization header %q", r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if m[1] != date.Format("20060102") {
+		f.t.Errorf("credential scope day %s does not match X-Amz-Date %s", m[1], r.Header.Get("X-Amz-Date"))
+	}
+
+	// Sign the same request with the service's credentials and compare
+	expected, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	f.verifier.sign(expected, date)
+
+	if expected.Header.Get("Authorization") != r.Header.Get("Authorization") {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			w.WriteHeader(http.StatusLengthRequired)
+			return
+		}
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		f.objects[r.URL.Path] = b
+	case http.MethodGet:
+		b, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<Error><Code>NoSuchKey</Code></Error>")
+			return
+		}
+
+		w.Write(b)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{
+		t:			t,
+		verifier:	&S3Store{Region: "us-east-1", AccessKey: "ak", SecretKey: "sk"},
+		objects:	map[string][]byte{},
+	}
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	return f, srv
+}
+
+/*	readerOnly hides every method of a reader but Read, so that its length is unknown	*/
+type readerOnly struct {
+	io.Reader
+}
+
+func TestSigningKey(t *testing.T) {
+	// The example from AWS's documentation on deriving a signing key
+	key := hmacSHA256([]byte("AWS4wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"), "20120215")
+	key = hmacSHA256(key, "us-east-1")
+	key = hmacSHA256(key, "iam")
+	key = hmacSHA256(key, "aws4_request")
+
+	want := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+	if got := hex.EncodeToString(key); got != want {
+		t.Errorf("signing key = %s, want %s", got, want)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	f, srv := newFakeS3(t)
+
+	s, err := NewS3Store(srv.URL+"/", "us-east-1", "bucket", "ak", "sk")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Put must find out the length of each kind of reader, since S3 needs it up front
+	tests := []struct {
+		name	string
+		body	string
+		r		io.Reader
+	}{
+		{"with length", "hello", strings.NewReader("hello")},
+		{"seeker", "hello, again", io.NewSectionReader(bytes.NewReader([]byte("hello, again")), 0, 12)},
+		{"unknown length", "hello, once more", readerOnly{strings.NewReader("hello, once more")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Put(key, tt.r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := s.Get(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer r.Close()
+
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.body {
+				t.Errorf("Get = %q, want %q", got, tt.body)
+			}
+		})
+	}
+
+	if _, ok := f.objects["/bucket/"+key]; !ok {
+		t.Errorf("object not stored at /bucket/%s", key)
+	}
+
+	err = s.Delete(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Get(key)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+
+	// Deleting a missing object is not an error
+	err = s.Delete(key)
+	if err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+}
+
+func TestS3StoreWrongCredentials(t *testing.T) {
+	_, srv := newFakeS3(t)
+
+	s, err := NewS3Store(srv.URL, "us-east-1", "bucket", "ak", "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Put("key", strings.NewReader("hello"))
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put with the wrong secret: got %v, want a SignatureDoesNotMatch failure", err)
+	}
+}
+
+func TestNewS3Store(t *testing.T) {
+	tests := []struct {
+		endpoint	string
+		bucket		string
+		valid		bool
+	}{
+		{"http://localhost:9000", "bucket", true},
+		{"https://s3.eu-west-1.amazonaws.com/", "bucket", true},
+		{"localhost:9000", "bucket", false},
+		{"ftp://localhost", "bucket", false},
+		{"http://", "bucket", false},
+		{"http://localhost:9000", "", false},
+	}
+
+	for _, tt := range tests {
+		_, err := NewS3Store(tt.endpoint, "us-east-1", tt.bucket, "ak", "sk")
+		if (err == nil) != tt.valid {
+			t.Errorf("NewS3Store(%q, %q): got error %v, want valid = %v", tt.endpoint, tt.bucket, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*	Op describes what happened to a line when going from the old text to the new one	*/
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+/*	Line is a single line of an edit script. OldNum and NewNum are the 1-based line
+	numbers on each side, or 0 if the line does not exist on that side	*/
+type Line struct {
+	Op		Op
+	Text	string
+	OldNum	int
+	NewNum	int
+}
+
+/*	Hunk groups a run of changed lines along with their surrounding context, in the
+	same way a unified diff does	*/
+type Hunk struct {
+	OldStart	int
+	OldLines	int
+	NewStart	int
+	NewLines	int
+	Lines		[]Line
+}
+
+/*	Header returns the "@@ -l,s +l,s @@" range line of the hunk	*/
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+/*	DefaultContext is the number of unchanged lines kept around each change	*/
+const DefaultContext = 3
+
+/*	Lines computes the line-by-line edit script that turns `a` into `b`. Lines keep
+	their trailing newline so that a missing newline at the end of the text is also
+	reported as a change. The script is only guaranteed to be the shortest one when
+	the texts differ by at most maxEdits lines; past that, everything between their
+	common prefix and suffix is reported as replaced	*/
+func Lines(a, b string) []Line {
+	oldLines := splitLines(a)
+	newLines := splitLines(b)
+
+	// Strip the common prefix and suffix first, since the search is quadratic on
+	// the number of differences and most edits only touch a few lines
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	var script []Line
+
+	for i := 0; i < prefix; i++ {
+		script = append(script, Line{Op: Equal, Text: oldLines[i]})
+	}
+
+	script = append(script, myers(oldLines[prefix:len(oldLines)-suffix], newLines[prefix:len(newLines)-suffix])...)
+
+	for i := len(oldLines) - suffix; i < len(oldLines); i++ {
+		script = append(script, Line{Op: Equal, Text: oldLines[i]})
+	}
+
+	// Number the lines on each side now that the script is complete
+	oldNum, newNum := 0, 0
+	for i := range script {
+		switch script[i].Op {
+		case Equal:
+			oldNum++
+			newNum++
+			script[i].OldNum, script[i].NewNum = oldNum, newNum
+		case Delete:
+			oldNum++
+			script[i].OldNum = oldNum
+		case Insert:
+			newNum++
+			script[i].NewNum = newNum
+		}
+	}
+
+	return script
+}
+
+/*	Anchor follows the old lines `start` to `end` through an edit script, returning the
+	range they moved to in the new text. The range only survives if its lines were
+	left untouched and nothing was inserted between them; otherwise, ok is false	*/
+func Anchor(script []Line, start, end int) (newStart, newEnd int, ok bool) {
+	kept := 0
+
+	for _, l := range script {
+		if l.OldNum < start || l.OldNum > end {
+			// Lines inserted inside the range split it
+			if l.Op == Insert && newStart > 0 && kept < end-start+1 {
+				return 0, 0, false
+			}
+			continue
+		}
+
+		if l.Op != Equal {
+			return 0, 0, false
+		}
+
+		if newStart == 0 {
+			newStart = l.NewNum
+		}
+		newEnd = l.NewNum
+		kept++
+	}
+
+	if kept != end-start+1 {
+		return 0, 0, false
+	}
+
+	return newStart, newEnd, true
+}
+
+/*	Hunks groups the changes of an edit script into hunks, keeping up to `context`
+	unchanged lines around each of them. Changes closer than twice the context are
+	merged into the same hunk	*/
+func Hunks(script []Line, context int) []Hunk {
+	var hunks []Hunk
+
+	i := 0
+	for i < len(script) {
+		// Find the next change
+		for i < len(script) && script[i].Op == Equal {
+			i++
+		}
+		if i == len(script) {
+			break
+		}
+
+		start := max(i-context, 0)
+
+		// Extend the hunk while the next change is close enough to share context
+		end := i
+		for end < len(script) {
+			if script[end].Op != Equal {
+				end++
+				continue
+			}
+
+			run := end
+			for run < len(script) && script[run].Op == Equal {
+				run++
+			}
+
+			if run == len(script) || run-end > 2*context {
+				end = min(end+context, len(script))
+				break
+			}
+
+			end = run
+		}
+
+		hunks = append(hunks, newHunk(script, start, end))
+		i = end
+	}
+
+	return hunks
+}
+
+/*	newHunk builds the hunk spanning script[start:end], computing its ranges	*/
+func newHunk(script []Line, start, end int) Hunk {
+	h := Hunk{Lines: script[start:end]}
+
+	// Count the lines that come before the hunk on each side
+	for _, l := range script[:start] {
+		if l.Op != Insert {
+			h.OldStart++
+		}
+		if l.Op != Delete {
+			h.NewStart++
+		}
+	}
+
+	for _, l := range h.Lines {
+		if l.Op != Insert {
+			h.OldLines++
+		}
+		if l.Op != Delete {
+			h.NewLines++
+		}
+	}
+
+	// Ranges are 1-based, except for empty ones which point at the preceding line
+	if h.OldLines > 0 {
+		h.OldStart++
+	}
+	if h.NewLines > 0 {
+		h.NewStart++
+	}
+
+	return h
+}
+
+/*	Unified formats the hunks as a unified diff that can be fed into `patch`	*/
+func Unified(oldName, newName string, hunks []Hunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	for _, h := range hunks {
+		sb.WriteString(h.Header())
+		sb.WriteByte('\n')
+
+		for _, l := range h.Lines {
+			switch l.Op {
+			case Equal:
+				sb.WriteByte(' ')
+			case Delete:
+				sb.WriteByte('-')
+			case Insert:
+				sb.WriteByte('+')
+			}
+
+			sb.WriteString(l.Text)
+
+			if !strings.HasSuffix(l.Text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+/*	splitLines splits the text into lines, keeping each line's terminating newline	*/
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+
+	// A trailing newline leaves an empty element behind which is not a line
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
@@ -0,0 +1,193 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+/*	ops renders the operations of an edit script compactly, one character per line	*/
+func ops(script []Line) string {
+	var sb strings.Builder
+
+	for _, l := range script {
+		sb.WriteByte(" +-"[l.Op])
+	}
+
+	return sb.String()
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name	string
+		a, b	string
+		ops		string
+	}{
+		{"identical", "a\nb\n", "a\nb\n", "  "},
+		{"both empty", "", "", ""},
+		{"from empty", "", "a\nb\n", "++"},
+		{"to empty", "a\nb\n", "", "--"},
+		{"changed line", "a\nb\nc\n", "a\nx\nc\n", " -+ "},
+		{"inserted line", "a\nc\n", "a\nb\nc\n", " + "},
+		{"deleted line", "a\nb\nc\n", "a\nc\n", " - "},
+		{"missing final newline", "a\nb\n", "a\nb", " -+"},
+		{"moved line", "a\nb\nc\n", "b\nc\na\n", "-  +"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := Lines(tt.a, tt.b)
+
+			if got := ops(script); got != tt.ops {
+				t.Errorf("ops = %q, want %q", got, tt.ops)
+			}
+
+			// Applying the script on either side gives back the original texts
+			var oldText, newText strings.Builder
+			for _, l := range script {
+				if l.Op != Insert {
+					oldText.WriteString(l.Text)
+				}
+				if l.Op != Delete {
+					newText.WriteString(l.Text)
+				}
+			}
+
+			if oldText.String() != tt.a || newText.String() != tt.b {
+				t.Errorf("script rebuilds %q and %q, want %q and %q", oldText.String(), newText.String(), tt.a, tt.b)
+			}
+		})
+	}
+}
+
+func TestAnchor(t *testing.T) {
+	const old = "1\n2\n3\n4\n5\n"
+
+	tests := []struct {
+		name		string
+		new			string
+		start, end	int
+		wantStart	int
+		wantEnd		int
+		ok			bool
+	}{
+		{"unchanged", old, 2, 3, 2, 3, true},
+		{"line added above", "0\n1\n2\n3\n4\n5\n", 2, 3, 3, 4, true},
+		{"line added below", "1\n2\n3\nx\n4\n5\n", 2, 3, 2, 3, true},
+		{"line added inside", "1\n2\nx\n3\n4\n5\n", 2, 3, 0, 0, false},
+		{"line removed inside", "1\n3\n4\n5\n", 2, 3, 0, 0, false},
+		{"line edited inside", "1\n2\n3x\n4\n5\n", 2, 3, 0, 0, false},
+		{"last line", "1\n2\n3\n4\n5\n6\n", 5, 5, 5, 5, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, ok := Anchor(Lines(old, tt.new), tt.start, tt.end)
+
+			if start != tt.wantStart || end != tt.wantEnd || ok != tt.ok {
+				t.Errorf("Anchor(%d, %d) = %d, %d, %v, want %d, %d, %v",
+						 tt.start, tt.end, start, end, ok, tt.wantStart, tt.wantEnd, tt.ok)
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name		string
+		a, b		string
+		context		int
+		want		string
+	}{
+		{
+			"no changes",
+			"a\nb\n", "a\nb\n", 3,
+			"",
+		},
+		{
+			"single change",
+			"a\nb\nc\n", "a\nx\nc\n", 1,
+			"--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			"from empty",
+			"", "x\n", 3,
+			"--- old\n+++ new\n@@ -0,0 +1,1 @@\n+x\n",
+		},
+		{
+			"distant changes",
+			"1\n2\n3\n4\n5\n6\n7\n8\n", "x\n2\n3\n4\n5\n6\n7\ny\n", 1,
+			"--- old\n+++ new\n@@ -1,2 +1,2 @@\n-1\n+x\n 2\n@@ -7,2 +7,2 @@\n 7\n-8\n+y\n",
+		},
+		{
+			"close changes share a hunk",
+			"1\n2\n3\n4\n", "x\n2\n3\ny\n", 1,
+			"--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n-4\n+y\n",
+		},
+		{
+			"missing final newline",
+			"a\n", "a\nb", 3,
+			"--- old\n+++ new\n@@ -1,1 +1,2 @@\n a\n+b\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified("old", "new", Hunks(Lines(tt.a, tt.b), tt.context))
+			if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinesMaxEdits(t *testing.T) {
+	// Every other line changes, so the shortest script keeps the even lines and
+	// takes one edit per changed line on each side
+	text := func(changed string, n int) string {
+		var sb strings.Builder
+		for i := range n {
+			if i%2 == 0 {
+				fmt.Fprintf(&sb, "same %d\n", i)
+			} else {
+				fmt.Fprintf(&sb, "%s %d\n", changed, i)
+			}
+		}
+		return sb.String()
+	}
+
+	tests := []struct {
+		name	string
+		lines	int
+		equal	int
+	}{
+		{"under the limit", maxEdits, maxEdits / 2},
+		// Only the common first line is kept once the search gives up
+		{"over the limit", maxEdits + 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := text("old", tt.lines), text("new", tt.lines)
+			script := Lines(a, b)
+
+			if got := strings.Count(ops(script), " "); got != tt.equal {
+				t.Errorf("%d unchanged lines, want %d", got, tt.equal)
+			}
+
+			var oldText, newText strings.Builder
+			for _, l := range script {
+				if l.Op != Insert {
+					oldText.WriteString(l.Text)
+				}
+				if l.Op != Delete {
+					newText.WriteString(l.Text)
+				}
+			}
+
+			if oldText.String() != a || newText.String() != b {
+				t.Error("script does not rebuild the original texts")
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package diff
+
+/*	maxEdits is the most insertions and deletions the search for a shortest edit
+	script goes through. The paths it keeps grow with the square of that number, so
+	texts that differ by more are reported as replaced as a whole instead	*/
+const maxEdits = 1000
+
+/*	myers computes a shortest edit script between `a` and `b` using Myers' O(ND)
+	algorithm. Only the furthest reaching paths of each step are kept, so memory
+	grows with the square of the number of differences rather than the input size.
+	Past maxEdits differences, it gives up and returns replace(a, b)	*/
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+
+	// trace[d][k+d] holds the furthest x reached on diagonal k after d edits
+	var trace [][]int
+
+	v := []int{0}
+
+	for d := 0; d <= n+m; d++ {
+		if d > maxEdits {
+			return replace(a, b)
+		}
+
+
+		next := make([]int, 2*d+1)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+
+			// Either move down (an insertion) from diagonal k+1 or right (a deletion)
+			// from diagonal k-1, whichever reached further
+			if k == -d || (k != d && at(v, d-1, k-1) < at(v, d-1, k+1)) {
+				x = at(v, d-1, k+1)
+			} else {
+				x = at(v, d-1, k-1) + 1
+			}
+
+			y := x - k
+
+			// Follow the diagonal as long as the lines match
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			next[k+d] = x
+
+			if x >= n && y >= m {
+				trace = append(trace, next)
+				return backtrack(a, b, trace)
+			}
+		}
+
+		trace = append(trace, next)
+		v = next
+	}
+
+	// Unreachable, d = n+m always reaches the end
+	return nil
+}
+
+/*	replace returns the edit script that deletes every line of `a` and then inserts
+	every line of `b`	*/
+func replace(a, b []string) []Line {
+	script := make([]Line, 0, len(a)+len(b))
+
+	for _, text := range a {
+		script = append(script, Line{Op: Delete, Text: text})
+	}
+	for _, text := range b {
+		script = append(script, Line{Op: Insert, Text: text})
+	}
+
+	return script
+}
+
+/*	at reads diagonal k of the path vector of step d	*/
+func at(v []int, d, k int) int {
+	if d < 0 {
+		return 0
+	}
+	return v[k+d]
+}
+
+/*	backtrack walks the recorded paths from the end back to the start, producing
+	the edit script in order	*/
+func backtrack(a, b []string, trace [][]int) []Line {
+	var reversed []Line
+
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		k := x - y
+
+		if d == 0 {
+			// The first step can only be a diagonal from the origin
+			for x > 0 && y > 0 {
+				reversed = append(reversed, Line{Op: Equal, Text: a[x-1]})
+				x--
+				y--
+			}
+			break
+		}
+
+		prev := trace[d-1]
+
+		var prevK int
+		if k == -d || (k != d && at(prev, d-1, k-1) < at(prev, d-1, k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := at(prev, d-1, prevK)
+		prevY := prevX - prevK
+
+		// Undo the diagonal that followed the edit
+		for x > prevX && y > prevY {
+			reversed = append(reversed, Line{Op: Equal, Text: a[x-1]})
+			x--
+			y--
+		}
+
+		if x == prevX {
+			reversed = append(reversed, Line{Op: Insert, Text: b[y-1]})
+		} else {
+			reversed = append(reversed, Line{Op: Delete, Text: a[x-1]})
+		}
+
+		x, y = prevX, prevY
+	}
+
+	script := make([]Line, len(reversed))
+	for i, l := range reversed {
+		script[len(reversed)-1-i] = l
+	}
+
+	return script
+}
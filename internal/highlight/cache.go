@@ -0,0 +1,81 @@
+package highlight
+
+import (
+	"container/list"
+	"html/template"
+	"sync"
+)
+
+/*	Cache keeps the most recently used rendered outputs in memory, so that popular
+	snippets are not tokenized again on every view. It is bounded by the total size
+	of what it holds rather than by a number of entries, since a single output can
+	be as large as the snippet it comes from. It is safe for concurrent use	*/
+type Cache struct {
+	mu		sync.Mutex
+	// The most bytes the cached keys and outputs can take up, and how many they do
+	maxBytes	int
+	used		int
+	order	*list.List
+	entries	map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key		string
+	html	template.HTML
+}
+
+/*	size returns how many bytes the entry counts for	*/
+func (e *cacheEntry) size() int {
+	return len(e.key) + len(e.html)
+}
+
+/*	NewCache returns a cache holding up to `maxBytes` bytes of outputs	*/
+func NewCache(maxBytes int) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		order:	  list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+/*	Get returns the cached output for `key`, calling `render` and caching its result
+	if it is not there yet. Errors are returned as they are and never cached, and
+	neither are outputs too large to ever fit. The key must change whenever whatever
+	`render` depends on does	*/
+func (c *Cache) Get(key string, render func() (template.HTML, error)) (template.HTML, error) {
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		c.mu.Unlock()
+		return elem.Value.(*cacheEntry).html, nil
+	}
+	c.mu.Unlock()
+
+	// Render without holding the lock, so that other lookups are not blocked
+	out, err := render()
+	if err != nil {
+		return "", err
+	}
+
+	entry := &cacheEntry{key: key, html: out}
+	if entry.size() > c.maxBytes {
+		return out, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(entry)
+		c.used += entry.size()
+
+		// Evict the least recently used entries until everything fits again
+		for c.used > c.maxBytes {
+			oldest := c.order.Remove(c.order.Back()).(*cacheEntry)
+			delete(c.entries, oldest.key)
+			c.used -= oldest.size()
+		}
+	}
+
+	return out, nil
+}
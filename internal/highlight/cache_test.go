@@ -0,0 +1,93 @@
+package highlight
+
+import (
+	"errors"
+	"html/template"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	// Each entry takes up 9 bytes, its key and its output, so two of them fit
+	c := NewCache(20)
+
+	renders := 0
+	get := func(key string) template.HTML {
+		out, err := c.Get(key, func() (template.HTML, error) {
+			renders++
+			return template.HTML("<b>" + key + "</b>"), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	if got := get("a"); got != "<b>a</b>" {
+		t.Errorf("Get = %q, want %q", got, "<b>a</b>")
+	}
+	get("b")
+
+	// Using "a" makes "b" the least recently used entry, so it goes first
+	get("a")
+	get("c")
+
+	if renders != 3 {
+		t.Errorf("rendered %d times, want 3", renders)
+	}
+
+	// "b" is checked last, since rendering it again evicts another entry
+	for _, key := range []string{"a", "c"} {
+		before := renders
+		get(key)
+		if renders != before {
+			t.Errorf("%q was rendered again", key)
+		}
+	}
+
+	before := renders
+	get("b")
+	if renders == before {
+		t.Error(`"b" was not evicted`)
+	}
+}
+
+func TestCacheTooLarge(t *testing.T) {
+	c := NewCache(20)
+
+	renders := 0
+	render := func() (template.HTML, error) {
+		renders++
+		return "an output larger than the whole cache", nil
+	}
+
+	for range 2 {
+		out, err := c.Get("a", render)
+		if err != nil || out != "an output larger than the whole cache" {
+			t.Fatalf("Get = %q, %v", out, err)
+		}
+	}
+
+	if renders != 2 || c.used != 0 {
+		t.Errorf("rendered %d times with %d bytes used, want 2 and 0", renders, c.used)
+	}
+}
+
+func TestCacheError(t *testing.T) {
+	c := NewCache(20)
+
+	fail := errors.New("render failed")
+	_, err := c.Get("a", func() (template.HTML, error) {
+		return "", fail
+	})
+	if err != fail {
+		t.Fatalf("Get = %v, want %v", err, fail)
+	}
+
+	// Errors are not cached, so the next lookup renders again
+	out, err := c.Get("a", func() (template.HTML, error) {
+		return "ok", nil
+	})
+	if err != nil || out != "ok" {
+		t.Errorf("Get after an error = %q, %v, want %q", out, err, "ok")
+	}
+}
@@ -0,0 +1,82 @@
+package highlight
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+/*	hint is a pattern that suggests a snippet is written in a given language. The
+	weight is added to that language's score once per matching line	*/
+type hint struct {
+	language	string
+	rx			*regexp.Regexp
+	weight		int
+}
+
+var hints = []hint{
+	{"go", regexp.MustCompile(`^package \w+$`), 10},
+	{"go", regexp.MustCompile(`^func (\(\w+ \*?\w+\) )?\w+\(`), 5},
+	{"go", regexp.MustCompile(`:= |\bfmt\.|\berr != nil\b`), 3},
+	{"python", regexp.MustCompile(`^\s*def \w+\(.*\):\s*$`), 5},
+	{"python", regexp.MustCompile(`^\s*(import \w+|from [\w.]+ import )`), 3},
+	{"python", regexp.MustCompile(`^\s*(elif |class \w+.*:\s*$)|\bself\.`), 3},
+	{"javascript", regexp.MustCompile(`\b(const|let) \w+ = |=> |\bfunction\s*\w*\(`), 3},
+	{"javascript", regexp.MustCompile(`\bconsole\.\w+\(|\bdocument\.|\brequire\(`), 5},
+	{"sql", regexp.MustCompile(`(?i)^\s*(select .* from |insert into |create (table|index|database) |update \w+ set |delete from |alter table )`), 5},
+	{"shell", regexp.MustCompile(`^#!.*\b(ba|z)?sh\b`), 10},
+	{"shell", regexp.MustCompile(`^\s*(\$ |sudo |echo |export \w+=|cd |apt(-get)? |curl )`), 3},
+	{"yaml", regexp.MustCompile(`^---\s*$`), 3},
+	{"yaml", regexp.MustCompile(`^\s*(- )?[\w.-]+:( |$)`), 1},
+}
+
+/*	Detect guesses the language `src` is written in, returning Plain when nothing
+	stands out	*/
+func Detect(src string) string {
+	trimmed := strings.TrimSpace(src)
+
+	// JSON can be recognized for sure
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		return "json"
+	}
+
+	scores := make(map[string]int)
+
+	lines := strings.Split(src, "\n")
+	for _, line := range lines {
+		for _, h := range hints {
+			if h.rx.MatchString(line) {
+				scores[h.language] += h.weight
+			}
+		}
+	}
+
+	best, bestScore := Plain, 0
+	for _, lang := range Languages {
+		if scores[lang.Name] > bestScore {
+			best, bestScore = lang.Name, scores[lang.Name]
+		}
+	}
+
+	// YAML keys look like many other things, so only trust them if most lines have one
+	if best == "yaml" {
+		nonEmpty := 0
+		for _, line := range lines {
+			if strings.TrimSpace(line) != "" {
+				nonEmpty++
+			}
+		}
+
+		if bestScore < 2 || 2*bestScore < nonEmpty {
+			return Plain
+		}
+		return best
+	}
+
+	// A single weak hint is not enough to go on
+	if bestScore < 3 {
+		return Plain
+	}
+
+	return best
+}
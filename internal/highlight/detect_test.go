@@ -0,0 +1,33 @@
+package highlight
+
+import (
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name	string
+		src		string
+		want	string
+	}{
+		{"go", "package main\n\nfunc main() {\n}\n", "go"},
+		{"python", "def add(a, b):\n    return a + b\n", "python"},
+		{"javascript", "const x = 1;\nconsole.log(x);\n", "javascript"},
+		{"sql", "SELECT id FROM snippets;\n", "sql"},
+		{"shell", "#!/bin/bash\necho hi\n", "shell"},
+		{"json", `{"name": "x", "tags": [1, 2]}`, "json"},
+		{"invalid json", `{"name": }`, Plain},
+		{"yaml", "name: x\nversion: 2\n", "yaml"},
+		{"a single yaml key", "Note: remember this\nand that\nand more\n", Plain},
+		{"prose", "Just some words.\n", Plain},
+		{"empty", "", Plain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.src); got != tt.want {
+				t.Errorf("Detect(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package highlight
+
+import (
+	"html"
+	"html/template"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*	Token classes, used as CSS class names on the highlighted output	*/
+const (
+	classComment	= "c"
+	classString		= "s"
+	classNumber		= "n"
+	classKeyword	= "k"
+	classBuiltin	= "b"
+)
+
+/*	Highlight tokenizes `src` as the given language and renders it as HTML, one line
+	per span with its line number in front. Every piece of `src` is escaped, so the
+	result is safe to embed in a page. Unknown languages are rendered as plain text,
+	and Auto detects the language first	*/
+func Highlight(src, language string) template.HTML {
+	// Textareas submit CRLF line endings, which would show up as stray characters
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.TrimSuffix(src, "\n")
+
+	if language == Auto {
+		language = Detect(src)
+	}
+
+	lang := Lookup(language)
+	if lang == nil {
+		lang = Lookup(Plain)
+	}
+
+	w := newWriter()
+	lang.tokenize(src, w.write)
+
+	return template.HTML(w.close())
+}
+
+/*	tokenize splits `src` into tokens, calling `emit` with each of them and its class.
+	Text that does not belong to any token is emitted with an empty class	*/
+func (lang *Language) tokenize(src string, emit func(text, class string)) {
+	plainStart := 0
+
+	// flush emits the plain text accumulated before position i
+	flush := func(i int) {
+		if i > plainStart {
+			emit(src[plainStart:i], "")
+		}
+	}
+
+	i := 0
+	for i < len(src) {
+		end, class := lang.match(src, i)
+
+		if end > i {
+			flush(i)
+			emit(src[i:end], class)
+			i = end
+			plainStart = i
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(src[i:])
+		i += size
+	}
+
+	flush(len(src))
+}
+
+/*	match tries to read a token starting at src[i], returning where it ends and its
+	class. An end equal to i means there is no token there	*/
+func (lang *Language) match(src string, i int) (int, string) {
+	rest := src[i:]
+
+	for _, prefix := range lang.LineComments {
+		if strings.HasPrefix(rest, prefix) {
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			return i + end, classComment
+		}
+	}
+
+	for _, delims := range lang.BlockComments {
+		if strings.HasPrefix(rest, delims[0]) {
+			end := strings.Index(rest[len(delims[0]):], delims[1])
+			if end < 0 {
+				return len(src), classComment
+			}
+			return i + len(delims[0]) + end + len(delims[1]), classComment
+		}
+	}
+
+	c := rest[0]
+
+	if strings.IndexByte(lang.Quotes, c) >= 0 || strings.IndexByte(lang.RawQuotes, c) >= 0 {
+		return i + lang.scanString(rest), classString
+	}
+
+	// Identifiers and numbers must start on a word boundary
+	if i > 0 {
+		prev, _ := utf8.DecodeLastRuneInString(src[:i])
+		if isWord(prev) {
+			return i, ""
+		}
+	}
+
+	if c >= '0' && c <= '9' {
+		end := 1
+		for end < len(rest) && (isWord(rune(rest[end])) || rest[end] == '.') {
+			end++
+		}
+		return i + end, classNumber
+	}
+
+	r, _ := utf8.DecodeRuneInString(rest)
+	if unicode.IsLetter(r) || r == '_' {
+		end := strings.IndexFunc(rest, func(r rune) bool { return !isWord(r) })
+		if end < 0 {
+			end = len(rest)
+		}
+
+		word := rest[:end]
+		if lang.CaseInsensitive {
+			word = strings.ToLower(word)
+		}
+
+		switch {
+		case lang.Keywords[word]:
+			return i + end, classKeyword
+		case lang.Builtins[word]:
+			return i + end, classBuiltin
+		}
+
+		// Skip the whole word, so that no token is found in the middle of it
+		return i + end, ""
+	}
+
+	return i, ""
+}
+
+/*	scanString returns the length of the string literal at the start of `s`, which
+	begins with its quote character. Unterminated strings run until the end of the
+	line, or of the text if the quote allows multi-line strings	*/
+func (lang *Language) scanString(s string) int {
+	quote := s[0]
+	raw := strings.IndexByte(lang.RawQuotes, quote) >= 0
+	multiline := strings.IndexByte(lang.MultilineQuotes, quote) >= 0
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if !raw {
+				i++
+			}
+		case quote:
+			return i + 1
+		case '\n':
+			if !multiline {
+				return i
+			}
+		}
+	}
+
+	return len(s)
+}
+
+/*	isWord reports whether `r` can be part of an identifier	*/
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+/*	writer renders tokens into numbered lines. Tokens spanning several lines are
+	closed at the end of each line and reopened on the next one, so that every
+	line is a well formed element on its own	*/
+type writer struct {
+	sb		strings.Builder
+	line	int
+}
+
+func newWriter() *writer {
+	w := &writer{}
+	w.openLine()
+	return w
+}
+
+func (w *writer) openLine() {
+	w.line++
+	w.sb.WriteString(`<span class="line"><span class="ln">`)
+	w.sb.WriteString(strconv.Itoa(w.line))
+	w.sb.WriteString(`</span>`)
+}
+
+func (w *writer) write(text, class string) {
+	for i, part := range strings.Split(text, "\n") {
+		if i > 0 {
+			w.sb.WriteString("</span>\n")
+			w.openLine()
+		}
+
+		if part == "" {
+			continue
+		}
+
+		if class == "" {
+			w.sb.WriteString(html.EscapeString(part))
+			continue
+		}
+
+		w.sb.WriteString(`<span class="`)
+		w.sb.WriteString(class)
+		w.sb.WriteString(`">`)
+		w.sb.WriteString(html.EscapeString(part))
+		w.sb.WriteString(`</span>`)
+	}
+}
+
+func (w *writer) close() string {
+	w.sb.WriteString("</span>")
+	return w.sb.String()
+}
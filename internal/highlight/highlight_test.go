@@ -0,0 +1,114 @@
+package highlight
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+/*	lines wraps each of the given pieces of markup the way the writer renders a line	*/
+func lines(parts ...string) string {
+	var sb strings.Builder
+
+	for i, part := range parts {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(`<span class="line"><span class="ln">` + strconv.Itoa(i+1) + `</span>`)
+		sb.WriteString(part)
+		sb.WriteString("</span>")
+	}
+
+	return sb.String()
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name		string
+		src			string
+		language	string
+		want		string
+	}{
+		{
+			"keywords and builtins",
+			"func f() int",
+			"go",
+			lines(`<span class="k">func</span> f() <span class="b">int</span>`),
+		},
+		{
+			"strings are escaped",
+			`s := "<b>"`,
+			"go",
+			lines(`s := <span class="s">&#34;&lt;b&gt;&#34;</span>`),
+		},
+		{
+			"numbers only on word boundaries",
+			"x1 := 42",
+			"go",
+			lines(`x1 := <span class="n">42</span>`),
+		},
+		{
+			"keywords inside words",
+			"format iffy",
+			"go",
+			lines("format iffy"),
+		},
+		{
+			"line comment",
+			"x // a & b\ny",
+			"go",
+			lines(`x <span class="c">// a &amp; b</span>`, "y"),
+		},
+		{
+			"block comment across lines",
+			"/* a\nb */ x",
+			"go",
+			lines(`<span class="c">/* a</span>`, `<span class="c">b */</span> x`),
+		},
+		{
+			"unterminated string ends with the line",
+			"\"abc\nd",
+			"go",
+			lines(`<span class="s">&#34;abc</span>`, "d"),
+		},
+		{
+			"raw string spans lines",
+			"`a\nb`",
+			"go",
+			lines(`<span class="s">`+"`a</span>", `<span class="s">b`+"`</span>"),
+		},
+		{
+			"case insensitive keywords",
+			"SELECT 1",
+			"sql",
+			lines(`<span class="k">SELECT</span> <span class="n">1</span>`),
+		},
+		{
+			"line endings",
+			"a\r\nb\n",
+			Plain,
+			lines("a", "b"),
+		},
+		{
+			"unknown language",
+			"func <x>",
+			"cobol",
+			lines("func &lt;x&gt;"),
+		},
+		{
+			"detected language",
+			"package main\n\nfunc main() {}",
+			Auto,
+			lines(`<span class="k">package</span> main`, "", `<span class="k">func</span> main() {}`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(Highlight(tt.src, tt.language))
+			if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
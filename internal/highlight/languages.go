@@ -0,0 +1,165 @@
+package highlight
+
+import (
+	"strings"
+)
+
+/*	Language describes how to tokenize the source code of a given language. Only the
+	lexical elements that matter for highlighting are described: comments, strings,
+	numbers, keywords and builtins	*/
+type Language struct {
+	// Name is the identifier stored along with snippets, Label is shown to users
+	Name			string
+	Label			string
+	Extensions		[]string
+
+	LineComments	[]string
+	BlockComments	[][2]string
+	// Quotes start a string, RawQuotes a string with no escape sequences
+	Quotes			string
+	RawQuotes		string
+	// Strings delimited by any of these may span several lines
+	MultilineQuotes	string
+	CaseInsensitive	bool
+	Keywords		map[string]bool
+	Builtins		map[string]bool
+}
+
+/*	Auto is the language name that asks for the language to be detected	*/
+const Auto = "auto"
+
+/*	Plain is the language name of text that is not highlighted	*/
+const Plain = "plaintext"
+
+/*	Markdown is the language name of documents that are rendered rather than shown as
+	source. Highlighting them leaves them as plain text	*/
+const Markdown = "markdown"
+
+/*	words builds a set out of a space separated list of words	*/
+func words(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		set[w] = true
+	}
+	return set
+}
+
+/*	Languages lists every supported language, in the order they are offered to users	*/
+var Languages = []*Language{
+	{
+		Name: Plain, Label: "Plain text", Extensions: []string{".txt", ".log", ".text"},
+	},
+	{
+		Name: Markdown, Label: "Markdown", Extensions: []string{".md", ".markdown"},
+	},
+	{
+		Name: "go", Label: "Go", Extensions: []string{".go"},
+		LineComments: []string{"//"}, BlockComments: [][2]string{{"/*", "*/"}},
+		Quotes: `"'`, RawQuotes: "`", MultilineQuotes: "`",
+		Keywords: words(`break case chan const continue default defer else fallthrough for func go
+			goto if import interface map package range return select struct switch type var`),
+		Builtins: words(`append cap clear close complex copy delete imag len make max min new panic
+			print println real recover any bool byte comparable complex64 complex128 error float32
+			float64 int int8 int16 int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr
+			true false iota nil`),
+	},
+	{
+		Name: "python", Label: "Python", Extensions: []string{".py"},
+		LineComments: []string{"#"},
+		Quotes: `"'`,
+		Keywords: words(`and as assert async await break class continue def del elif else except
+			finally for from global if import in is lambda nonlocal not or pass raise return try
+			while with yield`),
+		Builtins: words(`True False None self print len range str int float list dict set tuple
+			open isinstance super enumerate zip map filter sorted`),
+	},
+	{
+		Name: "javascript", Label: "JavaScript", Extensions: []string{".js", ".mjs", ".ts"},
+		LineComments: []string{"//"}, BlockComments: [][2]string{{"/*", "*/"}},
+		Quotes: "\"'`", MultilineQuotes: "`",
+		Keywords: words(`async await break case catch class const continue debugger default delete
+			do else export extends finally for function if import in instanceof let new of return
+			static super switch this throw try typeof var void while with yield`),
+		Builtins: words(`true false null undefined NaN Infinity console window document JSON Math
+			Object Array String Number Boolean Promise Map Set Error`),
+	},
+	{
+		Name: "sql", Label: "SQL", Extensions: []string{".sql"},
+		LineComments: []string{"--", "#"}, BlockComments: [][2]string{{"/*", "*/"}},
+		Quotes: `'"`, RawQuotes: "`",
+		CaseInsensitive: true,
+		Keywords: words(`add all alter and as asc begin between by case check column commit
+			constraint create database default delete desc distinct drop else end exists foreign
+			from full group having if in index inner insert into is join key left like limit not
+			null on or order outer primary references right rollback select set table then
+			transaction union unique update values view when where`),
+		Builtins: words(`int integer bigint smallint varchar char text datetime date timestamp
+			boolean bool decimal float double count sum avg min max now coalesce concat
+			utc_timestamp true false`),
+	},
+	{
+		Name: "shell", Label: "Shell", Extensions: []string{".sh", ".bash", ".zsh"},
+		LineComments: []string{"#"},
+		Quotes: `"`, RawQuotes: `'`, MultilineQuotes: `"'`,
+		Keywords: words(`if then else elif fi for while until do done case esac in function
+			return exit break continue local export`),
+		Builtins: words(`echo cd ls cat grep sed awk printf read set unset source test sudo
+			curl mkdir rm cp mv chmod chown`),
+	},
+	{
+		Name: "json", Label: "JSON", Extensions: []string{".json"},
+		Quotes: `"`,
+		Keywords: words(`true false null`),
+	},
+	{
+		Name: "yaml", Label: "YAML", Extensions: []string{".yaml", ".yml"},
+		LineComments: []string{"#"},
+		Quotes: `"`, RawQuotes: `'`,
+		Keywords: words(`true false null yes no on off`),
+	},
+}
+
+/*	Lookup returns the language with the given name, or nil if it is not supported	*/
+func Lookup(name string) *Language {
+	for _, lang := range Languages {
+		if lang.Name == name {
+			return lang
+		}
+	}
+	return nil
+}
+
+/*	Names returns the names accepted when creating a snippet, including Auto	*/
+func Names() []string {
+	names := []string{Auto}
+	for _, lang := range Languages {
+		names = append(names, lang.Name)
+	}
+	return names
+}
+
+/*	Extension returns the usual file extension, such as ".go", of the language with the
+	given name. Unknown languages, and those without an extension, get ".txt"	*/
+func Extension(name string) string {
+	lang := Lookup(name)
+	if lang == nil || len(lang.Extensions) == 0 {
+		return ".txt"
+	}
+	return lang.Extensions[0]
+}
+
+/*	ByExtension returns the name of the language a file extension such as ".go"
+	belongs to, or Plain if it is not recognized	*/
+func ByExtension(ext string) string {
+	ext = strings.ToLower(ext)
+
+	for _, lang := range Languages {
+		for _, e := range lang.Extensions {
+			if e == ext {
+				return lang.Name
+			}
+		}
+	}
+
+	return Plain
+}
@@ -0,0 +1,62 @@
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+/*	converter turns GitHub flavored Markdown into HTML: tables, fenced code blocks,
+	task lists, strikethrough and autolinks. Raw HTML in the source is dropped by
+	goldmark, and table alignments are rendered as attributes rather than inline
+	styles, which the Content-Security-Policy would block	*/
+var converter = goldmark.New(
+	goldmark.WithExtensions(
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		extension.Strikethrough,
+		extension.Linkify,
+		extension.TaskList,
+	),
+)
+
+/*	policy is the allowlist every rendered document goes through before being served.
+	It builds on bluemonday's policy for user generated content, which never allows
+	scripts, event handlers, styles or javascript: URLs, and only adds what the
+	Markdown extensions above produce	*/
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	// Task list items are rendered as disabled checkboxes
+	p.AllowElements("input")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	// Fenced code blocks keep their language as a class
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#.-]+$`)).OnElements("code")
+
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+
+	// Links open on the same tab and must not leak the page to their target
+	p.RequireNoFollowOnLinks(true)
+	p.RequireNoReferrerOnLinks(true)
+
+	return p
+}
+
+/*	Render converts the Markdown in `src` into sanitized HTML, safe to embed in a page	*/
+func Render(src string) (template.HTML, error) {
+	var buf bytes.Buffer
+
+	err := converter.Convert([]byte(src), &buf)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(policy.SanitizeBytes(buf.Bytes())), nil
+}
@@ -0,0 +1,108 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name		string
+		src			string
+		contains	[]string
+		excludes	[]string
+	}{
+		{
+			"heading",
+			"# Title",
+			[]string{"<h1>Title</h1>"},
+			nil,
+		},
+		{
+			"table alignment",
+			"| a | b |\n|:--|--:|\n| 1 | 2 |",
+			[]string{`<th align="left">a</th>`, `<td align="right">2</td>`},
+			[]string{"style="},
+		},
+		{
+			"task list",
+			"- [x] done\n- [ ] todo",
+			[]string{`<input checked="" disabled="" type="checkbox">`, `<input disabled="" type="checkbox">`},
+			nil,
+		},
+		{
+			"fenced code keeps its language",
+			"```go\nfmt.Println(1)\n```",
+			[]string{`<code class="language-go">`},
+			nil,
+		},
+		{
+			"strikethrough",
+			"~~gone~~",
+			[]string{"<del>gone</del>"},
+			nil,
+		},
+		{
+			"autolinks do not leak the page",
+			"see https://example.com",
+			[]string{`<a href="https://example.com" rel="nofollow noreferrer">`},
+			nil,
+		},
+		{
+			"raw script",
+			"<script>alert(1)</script>",
+			nil,
+			[]string{"<script", "alert(1)</"},
+		},
+		{
+			"event handlers",
+			`<img src="x" onerror="alert(1)">`,
+			nil,
+			[]string{"onerror"},
+		},
+		{
+			"javascript links",
+			"[click](javascript:alert(1))",
+			nil,
+			[]string{"javascript:"},
+		},
+		{
+			"inline styles",
+			`<p style="color: red">red</p>`,
+			nil,
+			[]string{"style="},
+		},
+		{
+			"other classes",
+			`<code class="evil">x</code>`,
+			nil,
+			[]string{"evil"},
+		},
+		{
+			"other input types",
+			`<input type="text" value="x">`,
+			nil,
+			[]string{`type="text"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := Render(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, s := range tt.contains {
+				if !strings.Contains(string(html), s) {
+					t.Errorf("Render(%q) = %q, missing %q", tt.src, html, s)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(string(html), s) {
+					t.Errorf("Render(%q) = %q, should not contain %q", tt.src, html, s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"snippetbox.octaviorassi.net/internal/diff"
+)
+
+/*	Annotation is a note attached to a range of lines of a snippet's content	*/
+type Annotation struct {
+	ID			int
+	SnippetID	int
+	UserID		int
+	// The name of the user who wrote the annotation
+	Author		string
+	// The 1-based lines the annotation refers to, both included
+	LineStart	int
+	LineEnd		int
+	Body		string
+	Created		time.Time
+	// Outdated annotations refer to lines that were changed by a later edit, and their
+	// line numbers are those of the content they were written on
+	Outdated	bool
+}
+
+type AnnotationModel struct {
+	DB 			*sql.DB
+}
+
+func NewAnnotationModel(db *sql.DB) (*AnnotationModel, error) {
+	return &AnnotationModel{ DB: db }, nil
+}
+
+/*	Insert adds an annotation by the user identified by `userID` on lines `lineStart`
+	to `lineEnd` of the snippet identified by `snippetID`	*/
+func (m *AnnotationModel) Insert(snippetID, userID, lineStart, lineEnd int, body string) (int, error) {
+
+	stmt := `INSERT INTO annotations (snippet_id, user_id, line_start, line_end, body, created)
+			 VALUES (?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, snippetID, userID, lineStart, lineEnd, body)
+	if err != nil { return 0, err }
+
+	id, err := result.LastInsertId()
+	if err != nil { return 0, err }
+
+	return int(id), nil
+}
+
+/*	Get returns the annotation identified by `id`	*/
+func (m *AnnotationModel) Get(id int) (Annotation, error) {
+
+	stmt := `SELECT a.id, a.snippet_id, a.user_id, u.name, a.line_start, a.line_end, a.body, a.created, a.outdated
+			 FROM annotations a JOIN users u ON u.id = a.user_id
+			 WHERE a.id = ?`
+
+	var a Annotation
+	err := m.DB.QueryRow(stmt, id).
+				Scan(&a.ID, &a.SnippetID, &a.UserID, &a.Author, &a.LineStart, &a.LineEnd, &a.Body, &a.Created, &a.Outdated)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Annotation{}, ErrNoRecord
+		}
+		return Annotation{}, err
+	}
+
+	return a, nil
+}
+
+/*	ForSnippet returns the annotations on the snippet identified by `snippetID`, in the
+	order they are shown: by the last line they refer to, then oldest first	*/
+func (m *AnnotationModel) ForSnippet(snippetID int) ([]Annotation, error) {
+
+	stmt := `SELECT a.id, a.snippet_id, a.user_id, u.name, a.line_start, a.line_end, a.body, a.created, a.outdated
+			 FROM annotations a JOIN users u ON u.id = a.user_id
+			 WHERE a.snippet_id = ?
+			 ORDER BY a.line_end, a.id`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var annotations []Annotation
+
+	for rows.Next() {
+		var a Annotation
+
+		err := rows.Scan(&a.ID, &a.SnippetID, &a.UserID, &a.Author, &a.LineStart, &a.LineEnd, &a.Body, &a.Created, &a.Outdated)
+		if err != nil {
+			return nil, err
+		}
+
+		annotations = append(annotations, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return annotations, nil
+}
+
+/*	Delete removes the annotation identified by `id`. Checking who may delete it is up
+	to the caller	*/
+func (m *AnnotationModel) Delete(id int) error {
+
+	result, err := m.DB.Exec(`DELETE FROM annotations WHERE id = ?`, id)
+	if err != nil { return err }
+
+	rows, err := result.RowsAffected()
+	if err != nil { return err }
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+/*	reanchorAnnotations moves the annotations of the snippet identified by `snippetID`
+	along with the lines they refer to, as its content goes from `oldContent` to
+	`newContent`. Annotations whose lines were changed are flagged as outdated and keep
+	their old line numbers. It runs within the transaction that saves the edit	*/
+func reanchorAnnotations(tx *sql.Tx, snippetID int, oldContent, newContent string) error {
+
+	rows, err := tx.Query(`SELECT id, line_start, line_end FROM annotations
+						   WHERE snippet_id = ? AND outdated = FALSE FOR UPDATE`, snippetID)
+	if err != nil {
+		return err
+	}
+
+	var annotations []Annotation
+
+	for rows.Next() {
+		var a Annotation
+
+		err := rows.Scan(&a.ID, &a.LineStart, &a.LineEnd)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		annotations = append(annotations, a)
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	script := diff.Lines(normalizeLines(oldContent), normalizeLines(newContent))
+
+	for _, a := range annotations {
+		start, end, ok := diff.Anchor(script, a.LineStart, a.LineEnd)
+
+		switch {
+		case !ok:
+			_, err = tx.Exec(`UPDATE annotations SET outdated = TRUE WHERE id = ?`, a.ID)
+		case start != a.LineStart:
+			_, err = tx.Exec(`UPDATE annotations SET line_start = ?, line_end = ? WHERE id = ?`, start, end, a.ID)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*	normalizeLines makes line endings uniform and terminates the last line, so that only
+	actual changes to a line's text tell it apart from the previous version	*/
+func normalizeLines(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return s
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+/*	Attachment is a file uploaded along with a snippet, such as a screenshot. Its data
+	lives in a blob store, under BlobKey	*/
+type Attachment struct {
+	ID			int
+	SnippetID	int
+	Name		string
+	// The media type detected from the data when it was uploaded
+	ContentType	string
+	Size		int64
+	BlobKey		string
+	Created		time.Time
+}
+
+type AttachmentModel struct {
+	DB 			*sql.DB
+}
+
+func NewAttachmentModel(db *sql.DB) (*AttachmentModel, error) {
+	return &AttachmentModel{ DB: db }, nil
+}
+
+/*	insertAttachment records `a` as an attachment of the snippet identified by
+	`snippetID` within `tx`. Its data must already be in the blob store	*/
+func insertAttachment(tx *sql.Tx, snippetID int, a Attachment) error {
+
+	stmt := `INSERT INTO attachments (snippet_id, name, content_type, size, blob_key, created)
+			 VALUES (?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := tx.Exec(stmt, snippetID, a.Name, a.ContentType, a.Size, a.BlobKey)
+
+	return err
+}
+
+/*	Get returns the attachment identified by `id`, as long as its snippet still exists	*/
+func (m *AttachmentModel) Get(id int) (Attachment, error) {
+
+	stmt := `SELECT id, snippet_id, name, content_type, size, blob_key, created
+			 FROM attachments WHERE id = ? AND snippet_id IS NOT NULL`
+
+	var a Attachment
+	err := m.DB.QueryRow(stmt, id).
+				Scan(&a.ID, &a.SnippetID, &a.Name, &a.ContentType, &a.Size, &a.BlobKey, &a.Created)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Attachment{}, ErrNoRecord
+		}
+		return Attachment{}, err
+	}
+
+	return a, nil
+}
+
+/*	ForSnippet returns the attachments of the snippet identified by `snippetID`, in the
+	order they were uploaded	*/
+func (m *AttachmentModel) ForSnippet(snippetID int) ([]Attachment, error) {
+
+	stmt := `SELECT id, snippet_id, name, content_type, size, blob_key, created
+			 FROM attachments WHERE snippet_id = ?
+			 ORDER BY id`
+
+	return m.query(stmt, snippetID)
+}
+
+/*	Orphans returns up to `limit` attachments whose snippet was deleted. Their rows are
+	kept until the data they point to has been removed from the blob store	*/
+func (m *AttachmentModel) Orphans(limit int) ([]Attachment, error) {
+
+	stmt := `SELECT id, 0, name, content_type, size, blob_key, created
+			 FROM attachments WHERE snippet_id IS NULL
+			 ORDER BY id LIMIT ?`
+
+	return m.query(stmt, limit)
+}
+
+/*	Delete removes the record of the attachment identified by `id`. Removing its data
+	from the blob store is up to the caller	*/
+func (m *AttachmentModel) Delete(id int) error {
+
+	_, err := m.DB.Exec(`DELETE FROM attachments WHERE id = ?`, id)
+
+	return err
+}
+
+func (m *AttachmentModel) query(stmt string, args ...any) ([]Attachment, error) {
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var attachments []Attachment
+
+	for rows.Next() {
+		var a Attachment
+
+		err := rows.Scan(&a.ID, &a.SnippetID, &a.Name, &a.ContentType, &a.Size, &a.BlobKey, &a.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
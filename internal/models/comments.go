@@ -0,0 +1,186 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Comment struct {
+	ID			int
+	SnippetID	int
+	UserID		int
+	// The id of the comment this one replies to, or 0 if it starts a thread
+	ParentID	int
+	// The name of the user who wrote the comment
+	Author		string
+	Body		string
+	Created		time.Time
+	Edited		bool
+	// Deleted comments are kept, without their body, while they still have replies
+	Deleted		bool
+	Replies		[]*Comment
+}
+
+type CommentModel struct {
+	DB 			*sql.DB
+}
+
+func NewCommentModel(db *sql.DB) (*CommentModel, error) {
+	return &CommentModel{ DB: db }, nil
+}
+
+/*	Insert adds a comment by the user identified by `userID` to the snippet identified
+	by `snippetID`. A non-zero `parentID` makes it a reply to another comment	*/
+func (m *CommentModel) Insert(snippetID, userID, parentID int, body string) (int, error) {
+
+	stmt := `INSERT INTO comments (snippet_id, user_id, parent_id, body, created)
+			 VALUES (?, ?, NULLIF(?, 0), ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, snippetID, userID, parentID, body)
+	if err != nil { return 0, err }
+
+	id, err := result.LastInsertId()
+	if err != nil { return 0, err }
+
+	return int(id), nil
+}
+
+/*	Get returns the comment identified by `id`, unless it was deleted	*/
+func (m *CommentModel) Get(id int) (Comment, error) {
+
+	stmt := `SELECT c.id, c.snippet_id, c.user_id, IFNULL(c.parent_id, 0), u.name, c.body, c.created, c.updated IS NOT NULL
+			 FROM comments c JOIN users u ON u.id = c.user_id
+			 WHERE c.id = ? AND c.deleted_at IS NULL`
+
+	var c Comment
+	err := m.DB.QueryRow(stmt, id).
+				Scan(&c.ID, &c.SnippetID, &c.UserID, &c.ParentID, &c.Author, &c.Body, &c.Created, &c.Edited)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Comment{}, ErrNoRecord
+		}
+		return Comment{}, err
+	}
+
+	return c, nil
+}
+
+/*	ForSnippet returns the comments on the snippet identified by `snippetID` as threads:
+	the comments starting a thread, oldest first, each with its replies nested in the
+	same order. Deleted comments only show up when some reply to them is still there	*/
+func (m *CommentModel) ForSnippet(snippetID int) ([]*Comment, error) {
+
+	stmt := `SELECT c.id, c.snippet_id, c.user_id, IFNULL(c.parent_id, 0), u.name, c.body, c.created,
+				c.updated IS NOT NULL, c.deleted_at IS NOT NULL
+			 FROM comments c JOIN users u ON u.id = c.user_id
+			 WHERE c.snippet_id = ?
+			 ORDER BY c.id`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var all []*Comment
+	byID := make(map[int]*Comment)
+
+	for rows.Next() {
+		c := &Comment{}
+
+		err := rows.Scan(&c.ID, &c.SnippetID, &c.UserID, &c.ParentID, &c.Author, &c.Body, &c.Created, &c.Edited, &c.Deleted)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, c)
+		byID[c.ID] = c
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Replies always come after their parent, since ids only grow
+	var threads []*Comment
+	for _, c := range all {
+		if parent, ok := byID[c.ParentID]; ok {
+			parent.Replies = append(parent.Replies, c)
+		} else {
+			threads = append(threads, c)
+		}
+	}
+
+	return prune(threads), nil
+}
+
+/*	prune drops the deleted comments that have no replies left, once their own replies
+	have been pruned	*/
+func prune(comments []*Comment) []*Comment {
+	var kept []*Comment
+
+	for _, c := range comments {
+		c.Replies = prune(c.Replies)
+
+		if !c.Deleted || len(c.Replies) > 0 {
+			kept = append(kept, c)
+		}
+	}
+
+	return kept
+}
+
+/*	Update replaces the body of the comment identified by `id`, as long as it was
+	written by the user identified by `userID`	*/
+func (m *CommentModel) Update(id, userID int, body string) error {
+
+	stmt := `UPDATE comments SET body = ?, updated = UTC_TIMESTAMP()
+			 WHERE id = ? AND user_id = ? AND deleted_at IS NULL`
+
+	result, err := m.DB.Exec(stmt, body, id, userID)
+	if err != nil { return err }
+
+	rows, err := result.RowsAffected()
+	if err != nil { return err }
+
+	if rows > 0 {
+		return nil
+	}
+
+	// MySQL only counts the rows it changed, so saving a comment as it already was,
+	// within the same second, affects none. Tell that apart from a missing comment
+	var exists bool
+	err = m.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM comments WHERE id = ? AND user_id = ? AND deleted_at IS NULL)`,
+						id, userID).Scan(&exists)
+	if err != nil { return err }
+
+	if !exists {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+/*	Delete removes the comment identified by `id`. Its body is erased, but the row is
+	kept so that the replies to it stay in their thread. Checking who may delete it is
+	up to the caller	*/
+func (m *CommentModel) Delete(id int) error {
+
+	stmt := `UPDATE comments SET body = '', deleted_at = UTC_TIMESTAMP()
+			 WHERE id = ? AND deleted_at IS NULL`
+
+	result, err := m.DB.Exec(stmt, id)
+	if err != nil { return err }
+
+	rows, err := result.RowsAffected()
+	if err != nil { return err }
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
@@ -0,0 +1,677 @@
+package models
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+)
+
+/*	Snippet bodies are stored once per distinct content, in the contents table, keyed
+	by the hex SHA-256 hash of the body and gzip compressed. Every snippet, revision and
+	file row holding a body counts as a reference to it, and bodies that are no longer
+	referenced are removed by PurgeContents. The compressed data is kept in the
+	database, or in the content store if it is larger than InlineLimit bytes. Every body
+	is also kept whole and uncompressed alongside it, as its search text, for full-text
+	search and search excerpts to work on.
+
+	Rows written before bodies were hashed still keep theirs in the content column, or
+	in the content store under a random key, until MigrateContent converts them	*/
+
+// The length of a content hash, which tells it apart from the random keys that were
+// used before bodies were hashed
+const contentHashLength = 2 * sha256.Size
+
+/*	errNoContentStore is returned when a body kept in the content store is needed but the
+	model was not given one	*/
+var errNoContentStore = errors.New("models: snippet content is stored externally but there is no content store")
+
+/*	contentTx is a transaction that stores bodies. The bodies it writes to the content
+	store are remembered, so that they can be removed again if it is rolled back	*/
+type contentTx struct {
+	*sql.Tx
+	written		[]string
+	committed	bool
+}
+
+/*	beginContent starts a transaction that stores bodies. It must be ended with
+	rollbackContent, which is deferred right away like Rollback on other transactions	*/
+func (m *SnippetModel) beginContent() (*contentTx, error) {
+	tx, err := m.DB.Begin()
+	if err != nil { return nil, err }
+
+	return &contentTx{Tx: tx}, nil
+}
+
+func (tx *contentTx) Commit() error {
+	tx.committed = true
+	return tx.Tx.Commit()
+}
+
+/*	rollbackContent rolls back `tx` unless it was committed, first removing the bodies
+	it wrote to the content store. They are removed while the transaction still locks
+	their contents rows, so that no one else can be storing the same body meanwhile.
+	Bodies whose removal fails, or which were written by a transaction whose commit
+	failed, are left behind: they only waste space, and are overwritten if the same
+	body is stored again	*/
+func (m *SnippetModel) rollbackContent(tx *contentTx) {
+	if !tx.committed {
+		m.deleteContent(tx.written)
+	}
+
+	tx.Rollback()
+}
+
+/*	storeContent adds a reference to the stored copy of `content` within `tx`, storing
+	it first if no row refers to the same body yet. It returns the hash the body is
+	stored under, which the row keeps as its content key, and how many bytes had to be
+	stored, search text included, which is 0 if the body was already there	*/
+func (m *SnippetModel) storeContent(tx *contentTx, content string) (hash string, stored int, err error) {
+	sum := sha256.Sum256([]byte(content))
+	hash = hex.EncodeToString(sum[:])
+
+	result, err := tx.Exec(`UPDATE contents SET refs = refs + 1 WHERE hash = ?`, hash)
+	if err != nil { return "", 0, err }
+
+	affected, err := result.RowsAffected()
+	if err != nil { return "", 0, err }
+
+	if affected > 0 {
+		return hash, 0, nil
+	}
+
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	_, err = io.WriteString(zw, content)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil { return "", 0, err }
+
+	// Large bodies go to the content store, where they are named by their hash too
+	data := buf.Bytes()
+	external := m.Store != nil && m.InlineLimit > 0 && len(data) > m.InlineLimit
+	if external {
+		data = nil
+	}
+
+	// Someone else may have stored the same body in the meantime, in which case the
+	// row is only updated. The row is written before the body goes to the content
+	// store, so that anyone storing the same body waits on its lock until this
+	// transaction ends
+	result, err = tx.Exec(`INSERT INTO contents (hash, size, stored_size, data, search_text, refs) VALUES (?, ?, ?, ?, ?, 1)
+						   ON DUPLICATE KEY UPDATE refs = refs + 1`,
+						   hash, len(content), buf.Len(), data, content)
+	if err != nil { return "", 0, err }
+
+	// MySQL counts an updated row as 2 affected rows, and an inserted one as 1
+	affected, err = result.RowsAffected()
+	if err != nil { return "", 0, err }
+
+	if affected != 1 {
+		return hash, 0, nil
+	}
+
+	if external {
+		tx.written = append(tx.written, hash)
+
+		err = m.Store.Put(hash, bytes.NewReader(buf.Bytes()))
+		if err != nil { return "", 0, err }
+	}
+
+	return hash, buf.Len() + len(content), nil
+}
+
+/*	inflate turns the content column and content key of a row into the body itself,
+	as long as it is kept in the database. Bodies in the content store are left to be
+	opened with OpenContent, with an empty content	*/
+func inflate(q querier, content, key string) (string, string, error) {
+	if len(key) != contentHashLength {
+		return content, key, nil
+	}
+
+	var data []byte
+	err := q.QueryRow(`SELECT data FROM contents WHERE hash = ?`, key).Scan(&data)
+	if err != nil { return "", "", err }
+
+	if data == nil {
+		return "", key, nil
+	}
+
+	body, err := gunzip(bytes.NewReader(data))
+	if err != nil { return "", "", err }
+
+	return body, "", nil
+}
+
+/*	OpenContent opens the body of a snippet or revision for reading, wherever it is
+	kept, decompressing it on the fly	*/
+func (m *SnippetModel) OpenContent(content, key string) (io.ReadCloser, error) {
+	if key == "" {
+		return io.NopCloser(strings.NewReader(content)), nil
+	}
+
+	var data []byte
+	if len(key) == contentHashLength {
+		err := m.DB.QueryRow(`SELECT data FROM contents WHERE hash = ?`, key).Scan(&data)
+		if err != nil { return nil, err }
+
+		if data != nil {
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil { return nil, err }
+
+			return zr, nil
+		}
+	}
+
+	if m.Store == nil {
+		return nil, errNoContentStore
+	}
+
+	r, err := m.Store.Get(key)
+	if err != nil { return nil, err }
+
+	// Bodies stored under a random key predate compression
+	if len(key) != contentHashLength {
+		return r, nil
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	return &compressedBody{Reader: zr, body: r}, nil
+}
+
+/*	compressedBody reads a compressed body from the content store, closing the store's
+	reader along with the decompressor	*/
+type compressedBody struct {
+	*gzip.Reader
+	body	io.ReadCloser
+}
+
+func (c *compressedBody) Close() error {
+	return errors.Join(c.Reader.Close(), c.body.Close())
+}
+
+/*	ReadContent returns the whole body of a snippet or revision, like OpenContent	*/
+func (m *SnippetModel) ReadContent(content, key string) (string, error) {
+	if key == "" {
+		return content, nil
+	}
+
+	r, err := m.OpenContent(content, key)
+	if err != nil { return "", err }
+
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil { return "", err }
+
+	return string(b), nil
+}
+
+/*	LoadContent reads the bodies of the snippet and its files into s.Content and their
+	Content if they are kept in the content store, for the pages that need all of them
+	at once	*/
+func (m *SnippetModel) LoadContent(s *Snippet) error {
+	content, err := m.ReadContent(s.Content, s.ContentKey)
+	if err != nil { return err }
+
+	s.Content, s.ContentKey = content, ""
+
+	for i := range s.Files {
+		f := &s.Files[i]
+
+		if i == 0 {
+			f.Content, f.ContentKey = content, ""
+			continue
+		}
+
+		f.Content, err = m.ReadContent(f.Content, f.ContentKey)
+		if err != nil { return err }
+
+		f.ContentKey = ""
+	}
+
+	return nil
+}
+
+/*	contentKeys returns the content keys of the snippets matching `where`, which may
+	refer to the snippets table as s, along with those of their revisions and files. It
+	is meant to be called within the transaction that deletes those snippets	*/
+func contentKeys(q querier, where string, args ...any) ([]string, error) {
+	stmt := `SELECT s.content_key FROM snippets s WHERE s.content_key IS NOT NULL AND ` + where + `
+			 UNION ALL
+			 SELECT r.content_key FROM snippet_revisions r JOIN snippets s ON s.id = r.snippet_id
+			 WHERE r.content_key IS NOT NULL AND ` + where + `
+			 UNION ALL
+			 SELECT f.content_key FROM snippet_files f JOIN snippets s ON s.id = f.snippet_id
+			 WHERE f.content_key IS NOT NULL AND ` + where
+
+	rows, err := q.Query(stmt, append(append(args, args...), args...)...)
+	if err != nil { return nil, err }
+
+	defer rows.Close()
+
+	var keys []string
+
+	for rows.Next() {
+		var key string
+
+		err := rows.Scan(&key)
+		if err != nil { return nil, err }
+
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+/*	releaseContent drops the references the given content keys hold, within the
+	transaction that deletes the rows holding them. Keys from before bodies were hashed
+	are not shared, so they are returned for deleteContent to remove once the
+	transaction is committed	*/
+func releaseContent(tx *sql.Tx, keys []string) ([]string, error) {
+	var unshared []string
+
+	for _, key := range keys {
+		if len(key) != contentHashLength {
+			unshared = append(unshared, key)
+			continue
+		}
+
+		_, err := tx.Exec(`UPDATE contents SET refs = refs - 1 WHERE hash = ?`, key)
+		if err != nil { return nil, err }
+	}
+
+	return unshared, nil
+}
+
+/*	deleteContent removes the given bodies from the content store once the rows
+	referring to them are gone. Every key is tried even if some fail	*/
+func (m *SnippetModel) deleteContent(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if m.Store == nil {
+		return errNoContentStore
+	}
+
+	var errs []error
+
+	for _, key := range keys {
+		errs = append(errs, m.Store.Delete(key))
+	}
+
+	return errors.Join(errs...)
+}
+
+/*	PurgeContents removes up to `limit` stored bodies that no snippet, revision or file
+	refers to anymore, returning how many were removed. Like PurgeTrash, it is meant to be
+	called repeatedly until it removes fewer than `limit` bodies	*/
+func (m *SnippetModel) PurgeContents(limit int) (int64, error) {
+
+	tx, err := m.DB.Begin()
+	if err != nil { return 0, err }
+
+	// Rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT hash, data IS NULL FROM contents WHERE refs <= 0 LIMIT ? FOR UPDATE`, limit)
+	if err != nil { return 0, err }
+
+	var hashes []any
+	var external []string
+
+	for rows.Next() {
+		var hash string
+		var inStore bool
+
+		err := rows.Scan(&hash, &inStore)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		hashes = append(hashes, hash)
+		if inStore {
+			external = append(external, hash)
+		}
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(hashes) == 0 {
+		return 0, nil
+	}
+
+	result, err := tx.Exec(`DELETE FROM contents WHERE hash IN (?` + strings.Repeat(`, ?`, len(hashes)-1) + `)`, hashes...)
+	if err != nil { return 0, err }
+
+	err = tx.Commit()
+	if err != nil { return 0, err }
+
+	// The rows are gone for good before their bodies are, so that a failure can never
+	// leave a row whose body is missing
+	for _, hash := range external {
+		err = m.deleteUnreferenced(hash)
+		if err != nil { return 0, err }
+	}
+
+	return result.RowsAffected()
+}
+
+/*	deleteUnreferenced removes the body stored under `hash` from the content store, as
+	long as it was not stored again since its row was purged. The row is locked while
+	the body is removed, or its absence if there is none, so that anyone storing the
+	same body meanwhile waits and then writes it afresh	*/
+func (m *SnippetModel) deleteUnreferenced(hash string) error {
+
+	tx, err := m.DB.Begin()
+	if err != nil { return err }
+
+	// Rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	var stored string
+	err = tx.QueryRow(`SELECT hash FROM contents WHERE hash = ? FOR UPDATE`, hash).Scan(&stored)
+	if err == nil {
+		return tx.Commit()
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	err = m.deleteContent([]string{hash})
+	if err != nil { return err }
+
+	return tx.Commit()
+}
+
+/*	MigrationReport sums up what MigrateContent converted	*/
+type MigrationReport struct {
+	// How many snippet, revision and file rows were converted
+	Rows		int
+	// How many bytes their bodies took before the conversion, counting both what the
+	// rows held and what was in the content store, and how many bytes had to be
+	// stored for them afterwards. Bodies shared by several rows are only stored once
+	Before		int64
+	After		int64
+}
+
+/*	Saved returns how many bytes the conversion saved	*/
+func (r MigrationReport) Saved() int64 {
+	return r.Before - r.After
+}
+
+/*	migratedTables lists the tables whose rows hold a body, with the statements
+	MigrateContent uses to find the rows still to convert and to point them at their
+	stored body	*/
+var migratedTables = []struct {
+	name		string
+	selectStmt	string
+	updateStmt	string
+}{
+	{
+		"snippets",
+		`SELECT id, version, content, IFNULL(content_key, '') FROM snippets
+		 WHERE content_key IS NULL OR CHAR_LENGTH(content_key) <> ?
+		 ORDER BY id LIMIT ? FOR UPDATE`,
+		`UPDATE snippets SET content = '', content_key = ? WHERE id = ? AND version = ?`,
+	},
+	{
+		"snippet_revisions",
+		`SELECT snippet_id, version, content, IFNULL(content_key, '') FROM snippet_revisions
+		 WHERE content_key IS NULL OR CHAR_LENGTH(content_key) <> ?
+		 ORDER BY snippet_id, version LIMIT ? FOR UPDATE`,
+		`UPDATE snippet_revisions SET content = '', content_key = ? WHERE snippet_id = ? AND version = ?`,
+	},
+	{
+		"snippet_files",
+		`SELECT snippet_id, position, content, IFNULL(content_key, '') FROM snippet_files
+		 WHERE content_key IS NULL OR CHAR_LENGTH(content_key) <> ?
+		 ORDER BY snippet_id, position LIMIT ? FOR UPDATE`,
+		`UPDATE snippet_files SET content = '', content_key = ? WHERE snippet_id = ? AND position = ?`,
+	},
+}
+
+/*	MigrateContent converts every snippet, revision and file whose body predates hashing,
+	whether it is in the content column or in the content store under a random key,
+	`limit` rows at a time. Stored bodies that have no search text yet, or only the
+	start of it, get the whole body as one, and rows that still keep a copy of it in
+	their content column have it cleared. It can be stopped and run again, since
+	converted rows are no longer picked up	*/
+func (m *SnippetModel) MigrateContent(limit int) (MigrationReport, error) {
+	var report MigrationReport
+
+	for _, table := range migratedTables {
+		for {
+			n, err := m.migrateBatch(table.selectStmt, table.updateStmt, limit, &report)
+			if err != nil { return report, err }
+
+			if n < limit {
+				break
+			}
+		}
+	}
+
+	var after string
+
+	for {
+		last, n, err := m.fillSearchText(after, limit, &report)
+		if err != nil { return report, err }
+
+		if n < limit {
+			break
+		}
+
+		after = last
+	}
+
+	for _, table := range migratedTables {
+		err := m.clearSearchCopies(table.name, limit, &report)
+		if err != nil { return report, err }
+	}
+
+	return report, nil
+}
+
+/*	migrateBatch converts one batch of rows for MigrateContent, returning how many rows
+	it converted	*/
+func (m *SnippetModel) migrateBatch(selectStmt, updateStmt string, limit int, report *MigrationReport) (int, error) {
+
+	type row struct {
+		id, version	int
+		content		string
+		key			string
+	}
+
+	tx, err := m.beginContent()
+	if err != nil { return 0, err }
+
+	// Bodies written to the content store are removed again unless committed
+	defer m.rollbackContent(tx)
+
+	rows, err := tx.Query(selectStmt, contentHashLength, limit)
+	if err != nil { return 0, err }
+
+	var batch []row
+
+	for rows.Next() {
+		var r row
+
+		err := rows.Scan(&r.id, &r.version, &r.content, &r.key)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		batch = append(batch, r)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var converted MigrationReport
+	var unshared []string
+
+	for _, r := range batch {
+		body, err := m.ReadContent(r.content, r.key)
+		if err != nil { return 0, err }
+
+		hash, stored, err := m.storeContent(tx, body)
+		if err != nil { return 0, err }
+
+		_, err = tx.Exec(updateStmt, hash, r.id, r.version)
+		if err != nil { return 0, err }
+
+		// Bodies under a random key were kept whole in the content store, besides
+		// whatever the row held
+		converted.Before += int64(len(r.content))
+		if r.key != "" {
+			unshared = append(unshared, r.key)
+			converted.Before += int64(len(body))
+		}
+
+		converted.Rows++
+		converted.After += int64(stored)
+	}
+
+	err = tx.Commit()
+	if err != nil { return 0, err }
+
+	report.Rows += converted.Rows
+	report.Before += converted.Before
+	report.After += converted.After
+
+	// Bodies under random keys now have a hashed copy
+	err = m.deleteContent(unshared)
+	if err != nil { return 0, err }
+
+	return len(batch), nil
+}
+
+/*	fillSearchText sets the whole body as the search text of up to `limit` stored bodies
+	that have none, or only the start of it as they used to, going through them in hash
+	order from `after`. It returns the last hash it went through and how many bodies it
+	filled in	*/
+func (m *SnippetModel) fillSearchText(after string, limit int, report *MigrationReport) (string, int, error) {
+
+	tx, err := m.DB.Begin()
+	if err != nil { return "", 0, err }
+
+	// Rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT hash, IFNULL(LENGTH(search_text), 0) FROM contents
+						   WHERE hash > ? AND (search_text IS NULL OR LENGTH(search_text) < size)
+						   ORDER BY hash LIMIT ? FOR UPDATE`, after, limit)
+	if err != nil { return "", 0, err }
+
+	type partial struct {
+		hash	string
+		length	int64
+	}
+
+	var batch []partial
+
+	for rows.Next() {
+		var p partial
+
+		err := rows.Scan(&p.hash, &p.length)
+		if err != nil {
+			rows.Close()
+			return "", 0, err
+		}
+
+		batch = append(batch, p)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return "", 0, err
+	}
+
+	var added int64
+
+	for _, p := range batch {
+		body, err := m.ReadContent("", p.hash)
+		if err != nil { return "", 0, err }
+
+		_, err = tx.Exec(`UPDATE contents SET search_text = ? WHERE hash = ?`, body, p.hash)
+		if err != nil { return "", 0, err }
+
+		added += int64(len(body)) - p.length
+	}
+
+	err = tx.Commit()
+	if err != nil { return "", 0, err }
+
+	report.After += added
+
+	if len(batch) > 0 {
+		after = batch[len(batch)-1].hash
+	}
+
+	return after, len(batch), nil
+}
+
+/*	clearSearchCopies empties the content column of the rows of `table` that point at a
+	stored body but still keep a copy of its search text, `limit` rows at a time	*/
+func (m *SnippetModel) clearSearchCopies(table string, limit int, report *MigrationReport) error {
+	where := ` WHERE CHAR_LENGTH(content_key) = ? AND content <> ''`
+
+	var copies int64
+	err := m.DB.QueryRow(`SELECT IFNULL(SUM(LENGTH(content)), 0) FROM ` + table + where, contentHashLength).Scan(&copies)
+	if err != nil { return err }
+
+	for {
+		result, err := m.DB.Exec(`UPDATE ` + table + ` SET content = ''` + where + ` LIMIT ?`, contentHashLength, limit)
+		if err != nil { return err }
+
+		n, err := result.RowsAffected()
+		if err != nil { return err }
+
+		if n < int64(limit) {
+			break
+		}
+	}
+
+	report.Before += copies
+
+	return nil
+}
+
+/*	gunzip decompresses everything read from `r`	*/
+func gunzip(r io.Reader) (string, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil { return "", err }
+
+	defer zr.Close()
+
+	b, err := io.ReadAll(zr)
+	if err != nil { return "", err }
+
+	return string(b), nil
+}
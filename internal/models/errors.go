@@ -12,4 +12,8 @@ var (
 
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 
+	ErrEditConflict = errors.New("models: edit conflict")
+
+	ErrInvalidCursor = errors.New("models: invalid cursor")
+
 )
\ No newline at end of file
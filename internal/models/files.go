@@ -0,0 +1,93 @@
+package models
+
+import (
+	"database/sql"
+)
+
+/*	File is one of the named files a snippet is made of. The first file of a snippet is
+	its main file, whose content and language are the snippet's own	*/
+type File struct {
+	// The file's name, which may be empty for the main file of a snippet that was
+	// created before snippets could hold several files
+	Name		string
+	Language	string
+	// Like the snippet's own, the content is empty if it is kept in the content store
+	// under ContentKey
+	Content		string
+	ContentKey	string
+}
+
+/*	querier runs queries either directly on the database or within a transaction	*/
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+/*	loadFiles fills in the files of `s`, in order, starting with its main file. Their
+	contents are decompressed, unless they are kept in the content store	*/
+func loadFiles(q querier, s *Snippet) error {
+
+	stmt := `SELECT IFNULL(s.filename, ''), f.name, f.language, f.content, IFNULL(f.content_key, '')
+			 FROM snippets s LEFT JOIN snippet_files f ON f.snippet_id = s.id
+			 WHERE s.id = ?
+			 ORDER BY f.position`
+
+	rows, err := q.Query(stmt, s.ID)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	files := []File{{Language: s.Language, Content: s.Content, ContentKey: s.ContentKey}}
+
+	for rows.Next() {
+		var name, language, content, key sql.NullString
+
+		err := rows.Scan(&files[0].Name, &name, &language, &content, &key)
+		if err != nil {
+			return err
+		}
+
+		// Snippets with a single file join with no file at all
+		if name.Valid {
+			files = append(files, File{Name: name.String, Language: language.String, Content: content.String, ContentKey: key.String})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// The rows are read before decompressing anything, since a transaction cannot run
+	// another query while they are open
+	rows.Close()
+
+	for i := range files[1:] {
+		f := &files[i+1]
+
+		f.Content, f.ContentKey, err = inflate(q, f.Content, f.ContentKey)
+		if err != nil { return err }
+	}
+
+	s.Files = files
+
+	return nil
+}
+
+/*	insertFiles adds `files` to the snippet identified by `snippetID` within `tx`, after
+	its main file and in the given order. Their contents are stored like the snippet's	*/
+func (m *SnippetModel) insertFiles(tx *contentTx, snippetID int, files []File) error {
+
+	for i, f := range files {
+		hash, _, err := m.storeContent(tx, f.Content)
+		if err != nil { return err }
+
+		_, err = tx.Exec(`INSERT INTO snippet_files (snippet_id, position, name, language, content, content_key)
+						  VALUES (?, ?, ?, ?, '', ?)`,
+						  snippetID, i + 1, f.Name, f.Language, hash)
+		if err != nil { return err }
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"crypto/rand"
+	"math/big"
+	"regexp"
+)
+
+/*	PublicIDLength is the number of characters of a snippet's public identifier. With
+	62 possible characters each, ids are far too sparse to be guessed	*/
+const PublicIDLength = 12
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var publicIDRx = regexp.MustCompile(`^[0-9A-Za-z]{12}$`)
+
+var digitsRx = regexp.MustCompile(`^[0-9]+$`)
+
+/*	ValidPublicID returns true if `s` is shaped like a snippet's public identifier	*/
+func ValidPublicID(s string) bool {
+	return publicIDRx.MatchString(s) && !digitsRx.MatchString(s)
+}
+
+/*	newPublicID generates a random, URL-safe public identifier. Identifiers made up
+	only of digits are never generated, so that they cannot be mistaken for the
+	legacy numeric ids	*/
+func newPublicID() (string, error) {
+	max := big.NewInt(int64(len(base62)))
+
+	for {
+		id := make([]byte, PublicIDLength)
+
+		for i := range id {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", err
+			}
+			id[i] = base62[n.Int64()]
+		}
+
+		if !digitsRx.Match(id) {
+			return string(id), nil
+		}
+	}
+}
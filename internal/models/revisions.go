@@ -0,0 +1,140 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+/*	Revision holds a previous version of a snippet's title and content, saved right
+	before an edit replaced it	*/
+type Revision struct {
+	SnippetID	int
+	Version		int
+	Title		string
+	// Like the snippet's own, the content is empty if it is kept in the content store
+	// under ContentKey
+	Content		string
+	ContentKey	string
+	Created		time.Time
+}
+
+/*	Update replaces the title and content of the snippet identified by `id`, keeping the
+	previous ones as a revision. ErrNoRecord is returned if the snippet is not owned by
+	`userID`, or expired or was deleted in the meantime. The edit is only applied if
+	the snippet is still at `version`; otherwise, ErrEditConflict is returned so that
+	concurrent edits are rejected instead of silently overwriting each other. The
+	snippet's annotations follow the lines they refer to through the edit	*/
+func (m *SnippetModel) Update(id, userID, version int, title, content string) error {
+
+	tx, err := m.beginContent()
+	if err != nil { return err }
+
+	// Bodies written to the content store are removed again unless committed
+	defer m.rollbackContent(tx)
+
+	// Lock the current version, whose content the annotations are anchored to. This
+	// is where concurrent edits are told apart, before the new body is stored
+	var currentVersion int
+	var oldContent, oldKey string
+	err = tx.QueryRow(`SELECT version, content, IFNULL(content_key, '') FROM snippets
+					   WHERE id = ? AND user_id = ? AND (expires IS NULL OR expires > UTC_TIMESTAMP())
+					   AND deleted_at IS NULL FOR UPDATE`,
+					   id, userID).Scan(&currentVersion, &oldContent, &oldKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	if currentVersion != version {
+		return ErrEditConflict
+	}
+
+	oldContent, err = m.ReadContent(oldContent, oldKey)
+	if err != nil { return err }
+
+	contentKey, _, err := m.storeContent(tx, content)
+	if err != nil { return err }
+
+	// Copy the current version into the revisions table before overwriting it. The
+	// revision takes over the reference to the previous body
+	_, err = tx.Exec(`INSERT INTO snippet_revisions (snippet_id, version, title, content, content_key, created)
+					  SELECT id, version, title, content, content_key, UTC_TIMESTAMP() FROM snippets
+					  WHERE id = ?`,
+					  id)
+	if err != nil { return err }
+
+	// The row is locked, so it is still live and at `version`
+	_, err = tx.Exec(`UPDATE snippets SET title = ?, content = '', content_key = ?, version = version + 1
+					  WHERE id = ?`,
+					  title, contentKey, id)
+	if err != nil { return err }
+
+	err = reanchorAnnotations(tx.Tx, id, oldContent, content)
+	if err != nil { return err }
+
+	return tx.Commit()
+}
+
+/*	Revisions returns every previous version of the snippet identified by `snippetID`,
+	newest first	*/
+func (m *SnippetModel) Revisions(snippetID int) ([]Revision, error) {
+
+	stmt := `SELECT r.snippet_id, r.version, r.title, r.content, IFNULL(r.content_key, ''), r.created
+			 FROM snippet_revisions r JOIN snippets s ON s.id = r.snippet_id
+			 WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.deleted_at IS NULL AND r.snippet_id = ?
+			 ORDER BY r.version DESC`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var revisions []Revision
+
+	for rows.Next() {
+		var r Revision
+
+		err := rows.Scan(&r.SnippetID, &r.Version, &r.Title, &r.Content, &r.ContentKey, &r.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+/*	Revision returns the given version of the snippet identified by `snippetID`, or
+	ErrNoRecord if it does not exist	*/
+func (m *SnippetModel) Revision(snippetID, version int) (Revision, error) {
+
+	stmt := `SELECT r.snippet_id, r.version, r.title, r.content, IFNULL(r.content_key, ''), r.created
+			 FROM snippet_revisions r JOIN snippets s ON s.id = r.snippet_id
+			 WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.deleted_at IS NULL AND r.snippet_id = ? AND r.version = ?`
+
+	var r Revision
+	err := m.DB.QueryRow(stmt, snippetID, version).
+				Scan(&r.SnippetID, &r.Version, &r.Title, &r.Content, &r.ContentKey, &r.Created)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Revision{}, ErrNoRecord
+		}
+		return Revision{}, err
+	}
+
+	r.Content, r.ContentKey, err = inflate(m.DB, r.Content, r.ContentKey)
+	if err != nil { return Revision{}, err }
+
+	return r, nil
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"strings"
+
+	"snippetbox.octaviorassi.net/internal/search"
+)
+
+/*	SearchResult is a snippet matching a search along with its relevance score	*/
+type SearchResult struct {
+	Snippet
+	Score	float64
+}
+
+/*	Search returns up to `limit` live public snippets whose title or content match the query,
+	most relevant first. Password protected snippets and those with limited views are
+	left out, since results show an excerpt of their content. Titles are matched through
+	the FULLTEXT index over snippets(title) and content through the one over the search
+	text kept once per stored body, in contents(search_text). Snippets whose body has
+	not been converted or given a search text by MigrateContent yet are matched on
+	their content column instead. Each term or phrase must be found in any of them and
+	no exclusion in any, while the query's natural language form ranks the results	*/
+func (m *SnippetModel) Search(q search.Query, limit int) ([]SearchResult, error) {
+
+	if q.Empty() {
+		return nil, nil
+	}
+
+	var conditions strings.Builder
+	args := []any{q.Natural(), q.Natural(), q.Natural()}
+
+	// Rows with no search text have a NULL one, whose relevance is taken as 0
+	matches := `(MATCH(s.title) AGAINST(? IN BOOLEAN MODE) OR IFNULL(MATCH(c.search_text) AGAINST(? IN BOOLEAN MODE), 0)
+				OR MATCH(s.content) AGAINST(? IN BOOLEAN MODE))`
+
+	required, excluded := q.Clauses()
+
+	for _, c := range required {
+		conditions.WriteString(` AND ` + matches)
+		args = append(args, c, c, c)
+	}
+	for _, c := range excluded {
+		conditions.WriteString(` AND NOT ` + matches)
+		args = append(args, c, c, c)
+	}
+
+	stmt := `SELECT s.id, s.public_id, IFNULL(s.user_id, 0), s.title, IFNULL(c.search_text, s.content), s.language, s.visibility, s.password_hash, s.views_left, IFNULL(s.parent_id, 0), s.created, s.expires, s.version,
+				MATCH(s.title) AGAINST(? IN NATURAL LANGUAGE MODE) + IFNULL(MATCH(c.search_text) AGAINST(? IN NATURAL LANGUAGE MODE), 0)
+				+ MATCH(s.content) AGAINST(? IN NATURAL LANGUAGE MODE) AS score
+			 FROM snippets s LEFT JOIN contents c ON c.hash = s.content_key
+			 WHERE (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.deleted_at IS NULL AND s.visibility = 'public'
+			 AND s.password_hash IS NULL AND s.views_left = 0` + conditions.String() + `
+			 ORDER BY score DESC, s.id DESC LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var results []SearchResult
+
+	for rows.Next() {
+		var r SearchResult
+
+		err := rows.Scan(&r.ID, &r.PublicID, &r.UserID, &r.Title, &r.Content, &r.Language, &r.Visibility, &r.HashedPassword, &r.ViewsLeft, &r.ParentID, &r.Created, &r.Expires, &r.Version, &r.Score)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
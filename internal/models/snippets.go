@@ -3,67 +3,375 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"math"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
+
+	"snippetbox.octaviorassi.net/internal/blob"
 )
 
 type Snippet struct {
 	ID		int
+	PublicID	string
+	// The id of the snippet's owner, or 0 for snippets created before they had owners
+	UserID	int
+	// The id of the snippet this one was forked from, or 0 if it is not a fork
+	ParentID	int
 	Title 	string
+	// The body of the snippet, or an empty string if it is kept in the content store
+	// under ContentKey, in which case it must be opened with OpenContent. Lists leave
+	// it empty either way, while search results hold the start of the body
 	Content	string
+	ContentKey	string
+	Language	string
+	Visibility	string
+	// The bcrypt hash of the password protecting the snippet, or nil if there is none
+	HashedPassword	[]byte
+	// How many more times the snippet can be viewed before it is deleted, or 0 if there
+	// is no limit
+	ViewsLeft	int
 	Created	time.Time
-	Expires	time.Time
+	// When the snippet expires, or nil if it never does
+	Expires	*time.Time
+	Version	int
+	Deleted	time.Time
+	Tags	[]string
+	// The files the snippet is made of, starting with its main file. Only filled in
+	// for a single snippet, not for lists
+	Files	[]File
+	// How many users starred the snippet, only filled in where it is shown
+	Stars	int
+}
+
+/*	Snippet visibilities. Public snippets are listed everywhere, unlisted ones can only
+	be reached through their URL and private ones only by their owner	*/
+const (
+	VisibilityPublic	= "public"
+	VisibilityUnlisted	= "unlisted"
+	VisibilityPrivate	= "private"
+)
+
+/*	Cursor marks a position in the list of live snippets, which is ordered from newest
+	to oldest, by the public id of the snippet at that position. A zero Cursor points
+	at the start of the list	*/
+type Cursor struct {
+	// Only list snippets older than this one
+	After	string
+	// Only list snippets newer than this one
+	Before	string
+}
+
+/*	SnippetPage is a single page of the list of live snippets. Next and Prev are the
+	cursors of the adjacent pages, and are only meaningful if HasNext and HasPrev are set */
+type SnippetPage struct {
+	Snippets	[]Snippet
+	Next		Cursor
+	Prev		Cursor
+	HasNext		bool
+	HasPrev		bool
 }
 
 type SnippetModel struct {
 	DB 			*sql.DB
 	InsertStmt 	*sql.Stmt
 	GetStmt 	*sql.Stmt
-	LatestStmt 	*sql.Stmt
+	GetPublicStmt	*sql.Stmt
+	OlderStmt 	*sql.Stmt
+	NewerStmt 	*sql.Stmt
+	ByUserStmt	*sql.Stmt
+	// Where compressed bodies larger than InlineLimit bytes are kept instead of the
+	// database. A nil Store or a non-positive limit keeps every body in the database
+	Store		blob.Store
+	InlineLimit	int
 }
 
 func NewSnippetModel(db *sql.DB) (*SnippetModel, error) {
 	insertStmt, err :=
-		db.Prepare(`INSERT INTO snippets (title, content, created, expires)
-			 		VALUES (?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`)
+		db.Prepare(`INSERT INTO snippets (public_id, user_id, parent_id, title, filename, content, content_key, language, visibility, password_hash, views_left, created, expires)
+			 		VALUES (?, ?, NULLIF(?, 0), ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(), ?)`)
 	if err != nil { return nil, err }
 
 	getStmt, err :=
-		db.Prepare(`SELECT id, title, content, created, expires FROM snippets
-			 		WHERE expires > UTC_TIMESTAMP() AND id = ?`)
+		db.Prepare(`SELECT id, public_id, IFNULL(user_id, 0), title, content, language, visibility, password_hash, views_left, IFNULL(parent_id, 0), created, expires, version, IFNULL(content_key, '') FROM snippets
+			 		WHERE (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL AND id = ?`)
+	if err != nil { return nil, err }
+
+	getPublicStmt, err :=
+		db.Prepare(`SELECT id, public_id, IFNULL(user_id, 0), title, content, language, visibility, password_hash, views_left, IFNULL(parent_id, 0), created, expires, version, IFNULL(content_key, '') FROM snippets
+			 		WHERE (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL AND public_id = ?`)
+	if err != nil { return nil, err }
+
+	olderStmt, err :=
+		db.Prepare(`SELECT id, public_id, IFNULL(user_id, 0), title, '', language, visibility, password_hash, views_left, IFNULL(parent_id, 0), created, expires, version FROM snippets
+					WHERE	(expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL AND visibility = 'public'
+					AND id < ?
+					ORDER BY id DESC LIMIT ?`)
+	if err != nil { return nil, err }
+
+	newerStmt, err :=
+		db.Prepare(`SELECT id, public_id, IFNULL(user_id, 0), title, '', language, visibility, password_hash, views_left, IFNULL(parent_id, 0), created, expires, version FROM snippets
+					WHERE	(expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL AND visibility = 'public'
+					AND id > ?
+					ORDER BY id ASC LIMIT ?`)
 	if err != nil { return nil, err }
 
-	latestStmt, err :=
-		db.Prepare(`SELECT id, title, content, created, expires FROM snippets
-					WHERE	expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`)		
+	byUserStmt, err :=
+		db.Prepare(`SELECT id, public_id, IFNULL(user_id, 0), title, '', language, visibility, password_hash, views_left, IFNULL(parent_id, 0), created, expires, version FROM snippets
+					WHERE	(expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL AND user_id = ?
+					ORDER BY id DESC`)
 	if err != nil { return nil, err }
 		
 	model := &SnippetModel{
 		DB : db,
 		InsertStmt: insertStmt,
 		GetStmt: getStmt,
-		LatestStmt: latestStmt,
+		GetPublicStmt: getPublicStmt,
+		OlderStmt: olderStmt,
+		NewerStmt: newerStmt,
+		ByUserStmt: byUserStmt,
 	}
 
 	return model, nil
 }
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+/*	NewSnippet holds everything a snippet is created with	*/
+type NewSnippet struct {
+	UserID		int
+	// The id of the snippet this one is forked from, or 0
+	ParentID	int
+	Title		string
+	// The name, content and language of the main file. The name may be left empty
+	Filename	string
+	Content		string
+	Language	string
+	// Any other files, kept in the given order
+	Files		[]File
+	Visibility	string
+	// A non-empty password protects the snippet, and only its bcrypt hash is stored
+	Password	string
+	// A positive MaxViews deletes the snippet once it has been viewed that many times
+	MaxViews	int
+	// A nil Expires keeps the snippet forever
+	Expires		*time.Time
+	Tags		[]string
+	// Attachments whose data is already in the blob store, under their BlobKey
+	Attachments	[]Attachment
+}
 
-	result, err := m.InsertStmt.Exec(title, content, expires)
-	if err != nil { return 0, err }
+/*	Insert creates a new snippet along with its files, tags and attachments, returning
+	both its internal id and the random public id it is reachable by. Either all of it
+	is saved or nothing is. The content is stored once for every snippet sharing it	*/
+func (m *SnippetModel) Insert(s NewSnippet) (int, string, error) {
 
-	id, err := result.LastInsertId()
-	if err != nil { return 0, err }
+	tx, err := m.beginContent()
+	if err != nil { return 0, "", err }
+
+	// Bodies written to the content store are removed again unless committed
+	defer m.rollbackContent(tx)
+
+	id, publicID, err := m.insert(tx, s)
+	if err != nil { return 0, "", err }
+
+	err = tx.Commit()
+	if err != nil { return 0, "", err }
+
+	return id, publicID, nil
+}
+
+/*	InsertMany creates every snippet in `snippets` like Insert, within a single
+	transaction: either all of them are saved or none is	*/
+func (m *SnippetModel) InsertMany(snippets []NewSnippet) error {
+
+	tx, err := m.beginContent()
+	if err != nil { return err }
+
+	// Bodies written to the content store are removed again unless committed
+	defer m.rollbackContent(tx)
+
+	for _, s := range snippets {
+		_, _, err = m.insert(tx, s)
+		if err != nil { return err }
+	}
+
+	return tx.Commit()
+}
+
+/*	insert creates the snippet described by `s` within `tx`, like Insert	*/
+func (m *SnippetModel) insert(tx *contentTx, s NewSnippet) (int, string, error) {
+
+	var hashedPassword []byte
+	if s.Password != "" {
+		var err error
+		hashedPassword, err = bcrypt.GenerateFromPassword([]byte(s.Password), 12)
+		if err != nil { return 0, "", err }
+	}
+
+	// The body is only referenced if the snippet is saved as well
+	contentKey, _, err := m.storeContent(tx, s.Content)
+	if err != nil { return 0, "", err }
+
+	insertStmt := tx.Stmt(m.InsertStmt)
+
+	var id int64
+	var publicID string
+
+	for {
+		publicID, err = newPublicID()
+		if err != nil { return 0, "", err }
+
+		result, err := insertStmt.Exec(publicID, s.UserID, s.ParentID, s.Title, s.Filename, "", contentKey, s.Language, s.Visibility, hashedPassword, s.MaxViews, s.Expires)
+		if err != nil {
+			// In the unlikely case the public id was already taken, try again with another one
+			var mySQLError *mysql.MySQLError
+			if errors.As(err, &mySQLError) {
+				if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "snippets_uc_public_id") {
+					continue
+				}
+			}
+
+			return 0, "", err
+		}
+
+		id, err = result.LastInsertId()
+		if err != nil { return 0, "", err }
+
+		break
+	}
+
+	err = m.insertFiles(tx, int(id), s.Files)
+	if err != nil { return 0, "", err }
+
+	err = setTags(tx.Tx, int(id), s.Tags)
+	if err != nil { return 0, "", err }
+
+	for _, a := range s.Attachments {
+		err = insertAttachment(tx.Tx, int(id), a)
+		if err != nil { return 0, "", err }
+	}
+
+	return int(id), publicID, nil
+}
+
+/*	Protected returns true if the snippet can only be read after entering its password	*/
+func (s Snippet) Protected() bool {
+	return s.HashedPassword != nil
+}
+
+/*	CheckPassword verifies `password` against the one protecting the snippet. It returns
+	ErrInvalidCredentials if they do not match	*/
+func (s Snippet) CheckPassword(password string) error {
+	err := bcrypt.CompareHashAndPassword(s.HashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
 
-	return int(id), nil
+	return nil
 }
 
-/* Get returns the Snippet identified by `id` if it exists, or an error if it does not */
+/*	GetByPublicID returns the Snippet reachable by `publicID`, along with its files, if
+	it exists, or an error if it does not */
+func (m *SnippetModel) GetByPublicID(publicID string) (Snippet, error) {
+
+	var s Snippet
+	err := m.GetPublicStmt.QueryRow(publicID).
+					 Scan(&s.ID, &s.PublicID, &s.UserID, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.HashedPassword, &s.ViewsLeft, &s.ParentID, &s.Created, &s.Expires, &s.Version, &s.ContentKey)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Snippet{}, ErrNoRecord
+		}
+		return Snippet{}, err
+	}
+
+	s.Content, s.ContentKey, err = inflate(m.DB, s.Content, s.ContentKey)
+	if err != nil { return Snippet{}, err }
+
+	err = loadFiles(m.DB, &s)
+	if err != nil { return Snippet{}, err }
+
+	return s, nil
+}
+
+/*	View returns the Snippet reachable by `publicID` like GetByPublicID, and also counts
+	a view against the snippet's remaining views if it has a limit. The snippet is
+	deleted along with its last view. The row stays locked until the view is counted,
+	so two concurrent views can never both read a snippet that had a single view left.
+	The returned Snippet is as it was before the view	*/
+func (m *SnippetModel) View(publicID string) (Snippet, error) {
+
+	tx, err := m.DB.Begin()
+	if err != nil { return Snippet{}, err }
+
+	// Rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	stmt := `SELECT id, public_id, IFNULL(user_id, 0), title, content, language, visibility, password_hash, views_left, IFNULL(parent_id, 0), created, expires, version, IFNULL(content_key, '')
+			 FROM snippets WHERE (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL AND public_id = ?
+			 FOR UPDATE`
+
+	var s Snippet
+	err = tx.QueryRow(stmt, publicID).
+			 Scan(&s.ID, &s.PublicID, &s.UserID, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.HashedPassword, &s.ViewsLeft, &s.ParentID, &s.Created, &s.Expires, &s.Version, &s.ContentKey)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Snippet{}, ErrNoRecord
+		}
+		return Snippet{}, err
+	}
+
+	s.Content, s.ContentKey, err = inflate(tx, s.Content, s.ContentKey)
+	if err != nil { return Snippet{}, err }
+
+	// Read the files before they go away along with the last view
+	err = loadFiles(tx, &s)
+	if err != nil { return Snippet{}, err }
+
+	var unshared []string
+
+	switch {
+	case s.ViewsLeft == 1:
+		// The body is read as well, since it may be removed from the content store
+		err = m.LoadContent(&s)
+		if err != nil { return Snippet{}, err }
+
+		var keys []string
+		keys, err = contentKeys(tx, `s.id = ?`, s.ID)
+		if err != nil { return Snippet{}, err }
+
+		unshared, err = releaseContent(tx, keys)
+		if err != nil { return Snippet{}, err }
+
+		// Skip the trash, the snippet is meant to be gone for good
+		_, err = tx.Exec(`DELETE FROM snippets WHERE id = ?`, s.ID)
+	case s.ViewsLeft > 1:
+		_, err = tx.Exec(`UPDATE snippets SET views_left = views_left - 1 WHERE id = ?`, s.ID)
+	}
+	if err != nil { return Snippet{}, err }
+
+	err = tx.Commit()
+	if err != nil { return Snippet{}, err }
+
+	err = m.deleteContent(unshared)
+	if err != nil { return Snippet{}, err }
+
+	return s, nil
+}
+
+/* Get returns the Snippet identified by `id`, along with its files, if it exists, or an error if it does not.
+   Its content is decompressed, unless it is kept in the content store */
 func (m *SnippetModel) Get(id int) (Snippet, error) {
 	
 	var s Snippet
 	err := m.GetStmt.QueryRow(id).
-					 Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+					 Scan(&s.ID, &s.PublicID, &s.UserID, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.HashedPassword, &s.ViewsLeft, &s.ParentID, &s.Created, &s.Expires, &s.Version, &s.ContentKey)
 
 	if err != nil {
 		// Check if the error is due to not finding any rows matching the ID
@@ -74,17 +382,107 @@ func (m *SnippetModel) Get(id int) (Snippet, error) {
 		}
 	}
 
+	s.Content, s.ContentKey, err = inflate(m.DB, s.Content, s.ContentKey)
+	if err != nil { return Snippet{}, err }
+
+	err = loadFiles(m.DB, &s)
+	if err != nil { return Snippet{}, err }
+
 	return s, nil
 }
 
-func (m *SnippetModel) Latest() ([]Snippet, error) {
+/*	List returns up to `limit` live public snippets starting from `cursor`, newest first. Pages
+	are found by seeking on the id rather than with an OFFSET, so they stay cheap and
+	stable no matter how deep into the list they are. It returns ErrInvalidCursor if
+	the cursor points at a snippet that does not exist	*/
+func (m *SnippetModel) List(cursor Cursor, limit int) (SnippetPage, error) {
+
+	var page SnippetPage
 
-	rows, err := m.LatestStmt.Query()
+	// Older snippets are listed from the cursor's After position, or from the newest
+	// snippet without one, and newer ones from its Before position
+	from, position := cursor.After, math.MaxInt64
+	stmt := m.OlderStmt
 
+	if cursor.Before != "" {
+		from, stmt = cursor.Before, m.NewerStmt
+	}
+
+	var err error
+	if from != "" {
+		position, err = m.cursorID(from)
+		if err != nil { return page, err }
+	}
+
+	// Fetch one extra snippet to find out whether there are more beyond this page
+	rows, err := stmt.Query(position, limit + 1)
+	if err != nil { return page, err }
+
+	snippets, err := scanSnippets(rows)
+	if err != nil {
+		return page, err
+	}
+
+	more := len(snippets) > limit
+	if more {
+		snippets = snippets[:limit]
+	}
+
+	if cursor.Before != "" {
+		// Newer snippets come in ascending order, so flip them back
+		slices.Reverse(snippets)
+		page.HasPrev = more
+		page.HasNext = true
+	} else {
+		page.HasPrev = cursor.After != ""
+		page.HasNext = more
+	}
+
+	page.Snippets = snippets
+
+	if len(snippets) > 0 {
+		page.Prev = Cursor{Before: snippets[0].PublicID}
+		page.Next = Cursor{After: snippets[len(snippets)-1].PublicID}
+	} else {
+		page.HasPrev, page.HasNext = false, false
+	}
+
+	return page, nil
+}
+
+/*	cursorID returns the id of the snippet a cursor points at, which may have been
+	deleted since, as long as its row still exists. Otherwise, the cursor cannot be
+	resumed and ErrInvalidCursor is returned	*/
+func (m *SnippetModel) cursorID(publicID string) (int, error) {
+
+	var id int
+	err := m.DB.QueryRow(`SELECT id FROM snippets WHERE public_id = ?`, publicID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidCursor
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+/*	ByUser returns every live snippet owned by the user identified by `userID`,
+	newest first	*/
+func (m *SnippetModel) ByUser(userID int) ([]Snippet, error) {
+
+	rows, err := m.ByUserStmt.Query(userID)
 	if err != nil {
 		return nil, err
 	}
 
+	return scanSnippets(rows)
+}
+
+/*	scanSnippets reads every row of the given resultset into a Snippet slice and
+	closes it afterwards	*/
+func scanSnippets(rows *sql.Rows) ([]Snippet, error) {
+
 	// The closing must be deferred after the error-checking because if it was 
 	// executed before checking. Otherwise, if an error happens at Query(), 
 	// a panic will attempt to close a nil resultset
@@ -97,7 +495,7 @@ func (m *SnippetModel) Latest() ([]Snippet, error) {
 	for rows.Next() {
 		var s Snippet
 				
-		err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err := rows.Scan(&s.ID, &s.PublicID, &s.UserID, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.HashedPassword, &s.ViewsLeft, &s.ParentID, &s.Created, &s.Expires, &s.Version)
 
 		// If any of the scans fails, the whole thing is aborted
 		if err != nil {
@@ -108,10 +506,184 @@ func (m *SnippetModel) Latest() ([]Snippet, error) {
 	}
 	
 	// Now we can retrieve any error encountered during the iteration
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
 	return snippets, nil
 }
 
+/*	ForkCount returns how many live snippets were forked from the snippet identified by
+	`id`	*/
+func (m *SnippetModel) ForkCount(id int) (int, error) {
+
+	stmt := `SELECT COUNT(*) FROM snippets
+			 WHERE parent_id = ? AND (expires IS NULL OR expires > UTC_TIMESTAMP()) AND deleted_at IS NULL`
+
+	var count int
+	err := m.DB.QueryRow(stmt, id).Scan(&count)
+	return count, err
+}
+
+/*	SetExpiry changes when the snippet identified by `id` expires, as long as it belongs
+	to the user identified by `userID` and has not expired yet. A nil `expires` keeps
+	the snippet forever	*/
+func (m *SnippetModel) SetExpiry(id, userID int, expires *time.Time) error {
+
+	stmt := `UPDATE snippets SET expires = ?
+			 WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+			 AND (expires IS NULL OR expires > UTC_TIMESTAMP())`
+
+	_, err := m.DB.Exec(stmt, expires, id, userID)
+	return err
+}
+
+/*	Delete moves the snippet identified by `id` to its owner's trash. It returns
+	ErrNoRecord if there is no such live snippet owned by `userID`	*/
+func (m *SnippetModel) Delete(id, userID int) error {
+
+	stmt := `UPDATE snippets SET deleted_at = UTC_TIMESTAMP()
+			 WHERE id = ? AND user_id = ? AND deleted_at IS NULL`
+
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil { return err }
+
+	affected, err := result.RowsAffected()
+	if err != nil { return err }
+
+	if affected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+/*	Trash returns the snippets owned by `userID` that were deleted less than `window`
+	ago and can therefore still be restored, most recently deleted first	*/
+func (m *SnippetModel) Trash(userID int, window time.Duration) ([]Snippet, error) {
+
+	stmt := `SELECT id, public_id, IFNULL(user_id, 0), title, '', language, visibility, password_hash, views_left, IFNULL(parent_id, 0), created, expires, version, deleted_at FROM snippets
+			 WHERE user_id = ? AND deleted_at > DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND)
+			 ORDER BY deleted_at DESC`
+
+	rows, err := m.DB.Query(stmt, userID, int(window.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		var s Snippet
+
+		err := rows.Scan(&s.ID, &s.PublicID, &s.UserID, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.HashedPassword, &s.ViewsLeft, &s.ParentID, &s.Created, &s.Expires, &s.Version, &s.Deleted)
+		if err != nil {
+			return nil, err
+		}
+
+		snippets = append(snippets, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+/*	Restore takes the snippet reachable by `publicID` out of its owner's trash, as long
+	as it was deleted less than `window` ago. It returns ErrNoRecord otherwise	*/
+func (m *SnippetModel) Restore(publicID string, userID int, window time.Duration) error {
+
+	stmt := `UPDATE snippets SET deleted_at = NULL
+			 WHERE public_id = ? AND user_id = ? AND deleted_at > DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND)`
+
+	result, err := m.DB.Exec(stmt, publicID, userID, int(window.Seconds()))
+	if err != nil { return err }
+
+	affected, err := result.RowsAffected()
+	if err != nil { return err }
+
+	if affected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+/*	PurgeTrash permanently deletes up to `limit` snippets that were moved to the trash
+	more than `window` ago, returning how many were removed. Deleting in batches keeps
+	each statement from locking the table for long, so callers are expected to call it
+	again until it removes fewer than `limit` snippets	*/
+func (m *SnippetModel) PurgeTrash(window time.Duration, limit int) (int64, error) {
+	return m.purge(limit, `s.deleted_at <= DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND)`, int(window.Seconds()))
+}
+
+/*	PurgeExpired permanently deletes up to `limit` snippets that have expired, returning
+	how many were removed. Like PurgeTrash, it is meant to be called repeatedly until it
+	removes fewer than `limit` snippets	*/
+func (m *SnippetModel) PurgeExpired(limit int) (int64, error) {
+	return m.purge(limit, `s.expires <= UTC_TIMESTAMP()`)
+}
+
+/*	purge permanently deletes up to `limit` snippets matching `where`, which refers to
+	the snippets table as s and takes `args`. The bodies the snippets and their
+	revisions kept in the content store are removed once the rows are gone	*/
+func (m *SnippetModel) purge(limit int, where string, args ...any) (int64, error) {
+
+	tx, err := m.DB.Begin()
+	if err != nil { return 0, err }
+
+	// Rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	// Pick the batch first, so that the content keys are looked up for the very same
+	// snippets that are deleted
+	rows, err := tx.Query(`SELECT s.id FROM snippets s WHERE `+where+` ORDER BY s.id LIMIT ? FOR UPDATE`, append(args, limit)...)
+	if err != nil { return 0, err }
+
+	var ids []any
+
+	for rows.Next() {
+		var id int
+
+		err := rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	placeholders := `(?` + strings.Repeat(`, ?`, len(ids)-1) + `)`
+
+	keys, err := contentKeys(tx, `s.id IN `+placeholders, ids...)
+	if err != nil { return 0, err }
+
+	unshared, err := releaseContent(tx, keys)
+	if err != nil { return 0, err }
+
+	result, err := tx.Exec(`DELETE FROM snippets WHERE id IN `+placeholders, ids...)
+	if err != nil { return 0, err }
+
+	err = tx.Commit()
+	if err != nil { return 0, err }
+
+	err = m.deleteContent(unshared)
+	if err != nil { return 0, err }
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+)
+
+type StarModel struct {
+	DB 			*sql.DB
+}
+
+func NewStarModel(db *sql.DB) (*StarModel, error) {
+	return &StarModel{ DB: db }, nil
+}
+
+/*	Toggle stars the snippet identified by `snippetID` for the user identified by
+	`userID`, or unstars it if it was already starred. It returns whether the snippet
+	ends up starred	*/
+func (m *StarModel) Toggle(userID, snippetID int) (bool, error) {
+
+	result, err := m.DB.Exec(`DELETE FROM stars WHERE user_id = ? AND snippet_id = ?`, userID, snippetID)
+	if err != nil { return false, err }
+
+	rows, err := result.RowsAffected()
+	if err != nil { return false, err }
+
+	if rows > 0 {
+		return false, nil
+	}
+
+	// Starring twice at once must not fail on the unique constraint
+	_, err = m.DB.Exec(`INSERT IGNORE INTO stars (user_id, snippet_id, created)
+						VALUES (?, ?, UTC_TIMESTAMP())`, userID, snippetID)
+	if err != nil { return false, err }
+
+	return true, nil
+}
+
+/*	Starred returns whether the user identified by `userID` starred the snippet
+	identified by `snippetID`	*/
+func (m *StarModel) Starred(userID, snippetID int) (bool, error) {
+
+	var starred bool
+	err := m.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM stars WHERE user_id = ? AND snippet_id = ?)`,
+						 userID, snippetID).Scan(&starred)
+
+	return starred, err
+}
+
+/*	Count returns how many users starred the snippet identified by `snippetID`	*/
+func (m *StarModel) Count(snippetID int) (int, error) {
+
+	var count int
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM stars WHERE snippet_id = ?`, snippetID).Scan(&count)
+
+	return count, err
+}
+
+/*	SetCounts fills in the Stars field of every snippet in `snippets` with a single
+	query	*/
+func (m *StarModel) SetCounts(snippets []Snippet) error {
+
+	if len(snippets) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(snippets))
+	for i, s := range snippets {
+		args[i] = s.ID
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(snippets)), ",")
+
+	rows, err := m.DB.Query(`SELECT snippet_id, COUNT(*) FROM stars
+							 WHERE snippet_id IN (`+placeholders+`)
+							 GROUP BY snippet_id`, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	counts := make(map[int]int)
+
+	for rows.Next() {
+		var id, count int
+
+		err := rows.Scan(&id, &count)
+		if err != nil {
+			return err
+		}
+
+		counts[id] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range snippets {
+		snippets[i].Stars = counts[snippets[i].ID]
+	}
+
+	return nil
+}
+
+/*	StarredBy returns the live snippets starred by the user identified by `userID`,
+	most recently starred first. Snippets made private since then are left out,
+	unless the user owns them	*/
+func (m *SnippetModel) StarredBy(userID int) ([]Snippet, error) {
+
+	stmt := `SELECT s.id, s.public_id, IFNULL(s.user_id, 0), s.title, '', s.language, s.visibility, s.password_hash, s.views_left, IFNULL(s.parent_id, 0), s.created, s.expires, s.version
+			 FROM snippets s
+			 JOIN stars st ON st.snippet_id = s.id
+			 WHERE st.user_id = ? AND (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.deleted_at IS NULL
+			 AND (s.visibility <> 'private' OR s.user_id = st.user_id)
+			 ORDER BY st.created DESC, st.id DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSnippets(rows)
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+)
+
+type TagModel struct {
+	DB 			*sql.DB
+}
+
+func NewTagModel(db *sql.DB) (*TagModel, error) {
+	return &TagModel{ DB: db }, nil
+}
+
+/*	ParseTags splits a comma separated list of tags, normalizing them to lowercase and
+	dropping empty entries and duplicates	*/
+func ParseTags(s string) []string {
+	var tags []string
+
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+/*	setTags tags the snippet identified by `snippetID` with `tags` within `tx`, creating
+	any tag that did not exist yet	*/
+func setTags(tx *sql.Tx, snippetID int, tags []string) error {
+
+	for _, tag := range tags {
+		_, err := tx.Exec("INSERT IGNORE INTO tags (name) VALUES (?)", tag)
+		if err != nil { return err }
+
+		_, err = tx.Exec(`INSERT INTO snippet_tags (snippet_id, tag_id)
+						  SELECT ?, id FROM tags WHERE name = ?`, snippetID, tag)
+		if err != nil { return err }
+	}
+
+	return nil
+}
+
+/*	ForSnippet returns the tags of the snippet identified by `snippetID`, sorted by name	*/
+func (m *TagModel) ForSnippet(snippetID int) ([]string, error) {
+
+	stmt := `SELECT t.name FROM tags t JOIN snippet_tags st ON st.tag_id = t.id
+			 WHERE st.snippet_id = ? ORDER BY t.name`
+
+	return m.queryNames(stmt, snippetID)
+}
+
+/*	Suggest returns up to `limit` tag names starting with `prefix`, the ones used by
+	the most live public snippets first	*/
+func (m *TagModel) Suggest(prefix string, limit int) ([]string, error) {
+
+	// Escape the LIKE wildcards so that they are matched literally
+	prefix = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+
+	stmt := `SELECT t.name FROM tags t
+			 JOIN snippet_tags st ON st.tag_id = t.id
+			 JOIN snippets s ON s.id = st.snippet_id
+			 WHERE t.name LIKE CONCAT(?, '%')
+			 AND (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.deleted_at IS NULL AND s.visibility = 'public'
+			 GROUP BY t.id, t.name ORDER BY COUNT(*) DESC, t.name LIMIT ?`
+
+	return m.queryNames(stmt, prefix, limit)
+}
+
+/*	queryNames runs a query returning a single column of tag names	*/
+func (m *TagModel) queryNames(stmt string, args ...any) ([]string, error) {
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var names []string
+
+	for rows.Next() {
+		var name string
+
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+/*	ByTag returns every live public snippet tagged with `tag`, newest first	*/
+func (m *SnippetModel) ByTag(tag string) ([]Snippet, error) {
+
+	stmt := `SELECT s.id, s.public_id, IFNULL(s.user_id, 0), s.title, '', s.language, s.visibility, s.password_hash, s.views_left, IFNULL(s.parent_id, 0), s.created, s.expires, s.version
+			 FROM snippets s
+			 JOIN snippet_tags st ON st.snippet_id = s.id
+			 JOIN tags t ON t.id = st.tag_id
+			 WHERE t.name = ? AND (s.expires IS NULL OR s.expires > UTC_TIMESTAMP()) AND s.deleted_at IS NULL
+			 AND s.visibility = 'public'
+			 ORDER BY s.id DESC`
+
+	rows, err := m.DB.Query(stmt, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSnippets(rows)
+}
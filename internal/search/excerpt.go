@@ -0,0 +1,77 @@
+package search
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+/*	Segment is a piece of text that either matched the query or not, so that the
+	matches can be highlighted when rendered	*/
+type Segment struct {
+	Text	string
+	Match	bool
+}
+
+/*	Highlight splits `text` into segments, marking every occurrence of the query's
+	terms and phrases as a match	*/
+func Highlight(text string, q Query) []Segment {
+	rx := q.matcher()
+	if rx == nil || text == "" {
+		return []Segment{{Text: text}}
+	}
+
+	var segments []Segment
+
+	last := 0
+	for _, loc := range rx.FindAllStringIndex(text, -1) {
+		if loc[0] > last {
+			segments = append(segments, Segment{Text: text[last:loc[0]]})
+		}
+		segments = append(segments, Segment{Text: text[loc[0]:loc[1]], Match: true})
+		last = loc[1]
+	}
+
+	if last < len(text) {
+		segments = append(segments, Segment{Text: text[last:]})
+	}
+
+	return segments
+}
+
+/*	Excerpt picks a window of about `width` bytes of `text` around the first match of
+	the query, with whitespace collapsed, and highlights the matches within it. If
+	nothing matches, the excerpt is taken from the start of the text	*/
+func Excerpt(text string, q Query, width int) []Segment {
+	text = strings.Join(strings.Fields(text), " ")
+
+	start := 0
+	if rx := q.matcher(); rx != nil {
+		if loc := rx.FindStringIndex(text); loc != nil {
+			// Leave some leading context before the match
+			start = max(loc[0]-width/4, 0)
+		}
+	}
+
+	end := min(start+width, len(text))
+
+	// Pull the window back if it ran past the end, so it stays as wide as possible
+	start = max(end-width, 0)
+
+	// Avoid cutting through a multi-byte character
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	excerpt := text[start:end]
+	if start > 0 {
+		excerpt = "…" + excerpt
+	}
+	if end < len(text) {
+		excerpt = excerpt + "…"
+	}
+
+	return Highlight(excerpt, q)
+}
@@ -0,0 +1,135 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name	string
+		text	string
+		query	string
+		want	[]Segment
+	}{
+		{
+			"no query",
+			"some text",
+			"",
+			[]Segment{{Text: "some text"}},
+		},
+		{
+			"no match",
+			"some text",
+			"other",
+			[]Segment{{Text: "some text"}},
+		},
+		{
+			"case insensitive",
+			"Foo and foo",
+			"foo",
+			[]Segment{{Text: "Foo", Match: true}, {Text: " and "}, {Text: "foo", Match: true}},
+		},
+		{
+			"longest needle wins",
+			"hello world",
+			`hello "hello world"`,
+			[]Segment{{Text: "hello world", Match: true}},
+		},
+		{
+			"excluded words are not highlighted",
+			"foo bar",
+			"foo -bar",
+			[]Segment{{Text: "foo", Match: true}, {Text: " bar"}},
+		},
+		{
+			"regexp characters",
+			"call a.b() here",
+			"a.b",
+			[]Segment{{Text: "call "}, {Text: "a.b", Match: true}, {Text: "() here"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Highlight(tt.text, Parse(tt.query))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Highlight(%q, %q) = %#v, want %#v", tt.text, tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+/*	join puts the segments of an excerpt back together	*/
+func join(segments []Segment) string {
+	var sb strings.Builder
+
+	for _, s := range segments {
+		sb.WriteString(s.Text)
+	}
+
+	return sb.String()
+}
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		name	string
+		text	string
+		query	string
+		width	int
+		want	string
+	}{
+		{
+			"short text",
+			"short   text\n",
+			"text",
+			40,
+			"short text",
+		},
+		{
+			"match near the start",
+			"foo bar baz qux quux corge grault garply",
+			"bar",
+			12,
+			"…oo bar baz q…",
+		},
+		{
+			"match in the middle",
+			"lorem ipsum dolor sit amet foo consectetur adipiscing elit sed do",
+			"foo",
+			20,
+			"…amet foo consectetur…",
+		},
+		{
+			"match near the end",
+			"lorem ipsum dolor sit amet foo",
+			"foo",
+			12,
+			"…sit amet foo",
+		},
+		{
+			"no match",
+			"lorem ipsum dolor sit amet",
+			"other",
+			11,
+			"lorem ipsum…",
+		},
+		{
+			"multi-byte characters are not cut",
+			"ééééé foo ééééé",
+			"foo",
+			9,
+			"…é foo éé…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := join(Excerpt(tt.text, Parse(tt.query), tt.width))
+			if got != tt.want {
+				t.Errorf("Excerpt(%q, %q, %d) = %q, want %q", tt.text, tt.query, tt.width, got, tt.want)
+			}
+		})
+	}
+}
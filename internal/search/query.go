@@ -0,0 +1,147 @@
+package search
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+/*	Query is a parsed search string. Terms and Phrases must all be present in a
+	result, while Excluded words must not	*/
+type Query struct {
+	Terms		[]string
+	Phrases		[]string
+	Excluded	[]string
+}
+
+/*	Parse splits a search string into its terms. Double quoted text is kept together
+	as a phrase and words or phrases prefixed with '-' are excluded. An unterminated quote runs
+	until the end of the string	*/
+func Parse(s string) Query {
+	var q Query
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, `-"`) {
+			excluded := s[0] == '-'
+			s = strings.TrimPrefix(s, "-")
+
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				end = len(s) - 1
+			}
+
+			if phrase := clean(s[1 : end+1]); phrase != "" {
+				if excluded {
+					q.Excluded = append(q.Excluded, phrase)
+				} else {
+					q.Phrases = append(q.Phrases, phrase)
+				}
+			}
+
+			s = s[min(end+2, len(s)):]
+			continue
+		}
+
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 {
+			end = len(s)
+		}
+
+		word := s[:end]
+		s = s[end:]
+
+		if strings.HasPrefix(word, "-") {
+			if word = clean(word[1:]); word != "" {
+				q.Excluded = append(q.Excluded, word)
+			}
+			continue
+		}
+
+		if word = clean(word); word != "" {
+			q.Terms = append(q.Terms, word)
+		}
+	}
+
+	return q
+}
+
+/*	clean strips the characters that have a special meaning in MySQL's boolean full
+	text syntax and collapses any remaining whitespace	*/
+func clean(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`+-<>()~*"@`, r) {
+			return ' '
+		}
+		return r
+	}, s)
+
+	return strings.Join(strings.Fields(s), " ")
+}
+
+/*	Empty returns true if the query has nothing to look for. A query made up only of
+	exclusions is also empty, since it would match everything	*/
+func (q Query) Empty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0
+}
+
+/*	Clauses renders every term and phrase of the query, and every exclusion, on its
+	own in MySQL's boolean full text syntax, without the operator that requires or
+	negates it. Terms also match as prefixes. They let each clause be looked for in
+	several FULLTEXT indexes	*/
+func (q Query) Clauses() (required, excluded []string) {
+	for _, t := range q.Terms {
+		// Terms with punctuation are split by the full text parser, so keep their
+		// words together by searching for them as a phrase instead
+		if strings.ContainsFunc(t, isSeparator) {
+			required = append(required, `"`+t+`"`)
+		} else {
+			required = append(required, t+"*")
+		}
+	}
+
+	for _, p := range q.Phrases {
+		required = append(required, `"`+p+`"`)
+	}
+
+	for _, e := range q.Excluded {
+		if strings.ContainsFunc(e, isSeparator) {
+			excluded = append(excluded, `"`+e+`"`)
+		} else {
+			excluded = append(excluded, e)
+		}
+	}
+
+	return required, excluded
+}
+
+/*	Natural renders the words that should be found as a plain string, which is used
+	to rank the results by relevance	*/
+func (q Query) Natural() string {
+	return strings.Join(append(append([]string{}, q.Terms...), q.Phrases...), " ")
+}
+
+/*	matcher returns a case insensitive regexp matching any of the query's terms or
+	phrases, or nil if there are none. Longer needles come first so that they win
+	over any shorter needle they contain	*/
+func (q Query) matcher() *regexp.Regexp {
+	if q.Empty() {
+		return nil
+	}
+
+	needles := append(append([]string{}, q.Phrases...), q.Terms...)
+
+	quoted := make([]string, len(needles))
+	for i, n := range needles {
+		quoted[i] = regexp.QuoteMeta(n)
+	}
+
+	slices.SortStableFunc(quoted, func(a, b string) int { return len(b) - len(a) })
+
+	return regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+}
+
+/*	isSeparator reports whether the full text parser would split words at `r`	*/
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+}
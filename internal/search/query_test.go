@@ -0,0 +1,97 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name	string
+		input	string
+		want	Query
+	}{
+		{
+			"empty",
+			"   ",
+			Query{},
+		},
+		{
+			"terms",
+			"  foo   bar ",
+			Query{Terms: []string{"foo", "bar"}},
+		},
+		{
+			"phrase",
+			`"hello world" foo`,
+			Query{Terms: []string{"foo"}, Phrases: []string{"hello world"}},
+		},
+		{
+			"exclusions",
+			`foo -bar -"baz qux"`,
+			Query{Terms: []string{"foo"}, Excluded: []string{"bar", "baz qux"}},
+		},
+		{
+			"term with punctuation",
+			"fmt.Println",
+			Query{Terms: []string{"fmt.Println"}},
+		},
+		{
+			"unterminated quote",
+			`foo "bar baz`,
+			Query{Terms: []string{"foo"}, Phrases: []string{"bar baz"}},
+		},
+		{
+			"operators are stripped",
+			`+foo* (bar) ~baz`,
+			Query{Terms: []string{"foo", "bar", "baz"}},
+		},
+		{
+			"only operators",
+			`+ - "" -""`,
+			Query{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := Parse(tt.input)
+
+			if !reflect.DeepEqual(q, tt.want) {
+				t.Errorf("Parse(%q) = %#v, want %#v", tt.input, q, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	tests := []struct {
+		input	string
+		empty	bool
+	}{
+		{"", true},
+		{"-only -excluded", true},
+		{"foo", false},
+		{`"a phrase"`, false},
+	}
+
+	for _, tt := range tests {
+		if got := Parse(tt.input).Empty(); got != tt.empty {
+			t.Errorf("Parse(%q).Empty() = %v, want %v", tt.input, got, tt.empty)
+		}
+	}
+}
+
+func TestClauses(t *testing.T) {
+	required, excluded := Parse(`foo a.b "bar baz" -qux -"x y"`).Clauses()
+
+	wantRequired := []string{"foo*", `"a.b"`, `"bar baz"`}
+	wantExcluded := []string{"qux", `"x y"`}
+
+	if !reflect.DeepEqual(required, wantRequired) {
+		t.Errorf("required = %q, want %q", required, wantRequired)
+	}
+	if !reflect.DeepEqual(excluded, wantExcluded) {
+		t.Errorf("excluded = %q, want %q", excluded, wantExcluded)
+	}
+}
@@ -12,6 +12,13 @@ type Validator struct {
 	FieldErrors 	map[string]string
 }
 
+/*	TagRx matches a single lowercase tag such as "go", "c++" or "ci-cd"	*/
+var TagRx = regexp.MustCompile(`^[a-z0-9][a-z0-9+#._-]{0,29}$`)
+
+/*	FilenameRx matches a plain file name such as "main.go" or "go.mod". Names cannot
+	contain slashes or spaces, nor start with a dot	*/
+var FilenameRx = regexp.MustCompile(`^[A-Za-z0-9_+-][A-Za-z0-9._+-]{0,99}$`)
+
 var EmailRx = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
 /*	Valid returns True if there are no errors registered	*/
@@ -68,12 +75,28 @@ func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
 
+/*	AllMatch() returns true if every one of the given values matches the provided regexp	*/
+func AllMatch(values []string, rx *regexp.Regexp) bool {
+	for _, value := range values {
+		if !rx.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
 
-
-
+/*	MaxCount() returns true if there are no more than n values	*/
+func MaxCount[T any](values []T, n int) bool {
+	return len(values) <= n
+}
 
 /*	PermittedValue() returns true if a value is in a list of specific permitted
 	values.	*/
 func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 	return slices.Contains(permittedValues, value)
-}
\ No newline at end of file
+}
+
+/*	InRange() returns true if a value is between min and max, both included.	*/
+func InRange(value, min, max int) bool {
+	return value >= min && value <= max
+}
@@ -0,0 +1,89 @@
+package validator
+
+import (
+	"testing"
+)
+
+func TestAllMatch(t *testing.T) {
+	tests := []struct {
+		name	string
+		values	[]string
+		want	bool
+	}{
+		{"no values", nil, true},
+		{"valid tags", []string{"go", "c++", "ci-cd", "c#", "node.js"}, true},
+		{"uppercase", []string{"go", "Go"}, false},
+		{"space", []string{"two words"}, false},
+		{"leading punctuation", []string{"-go"}, false},
+		{"too long", []string{"abcdefghijklmnopqrstuvwxyz01234"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AllMatch(tt.values, TagRx); got != tt.want {
+				t.Errorf("AllMatch(%q, TagRx) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxCount(t *testing.T) {
+	tests := []struct {
+		values	[]string
+		n		int
+		want	bool
+	}{
+		{nil, 0, true},
+		{[]string{"a", "b"}, 2, true},
+		{[]string{"a", "b", "c"}, 2, false},
+	}
+
+	for _, tt := range tests {
+		if got := MaxCount(tt.values, tt.n); got != tt.want {
+			t.Errorf("MaxCount(%q, %d) = %v, want %v", tt.values, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestInRange(t *testing.T) {
+	tests := []struct {
+		value	int
+		want	bool
+	}{
+		{0, false},
+		{1, true},
+		{50, true},
+		{100, true},
+		{101, false},
+	}
+
+	for _, tt := range tests {
+		if got := InRange(tt.value, 1, 100); got != tt.want {
+			t.Errorf("InRange(%d, 1, 100) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFilenameRx(t *testing.T) {
+	tests := []struct {
+		name	string
+		want	bool
+	}{
+		{"main.go", true},
+		{"go.mod", true},
+		{"Makefile", true},
+		{"a_b-c+d.tar.gz", true},
+		{"", false},
+		{".env", false},
+		{"dir/file.go", false},
+		{`dir\file.go`, false},
+		{"my file.go", false},
+		{"..", false},
+	}
+
+	for _, tt := range tests {
+		if got := Matches(tt.name, FilenameRx); got != tt.want {
+			t.Errorf("Matches(%q, FilenameRx) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
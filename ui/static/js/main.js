@@ -5,4 +5,33 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+// Suggest existing tags while typing on the create form. Only the last of the comma
+// separated tags is completed, keeping the ones before it as they are.
+var tagsInput = document.querySelector("input[name='tags']");
+var tagSuggestions = document.getElementById("tag-suggestions");
+
+if (tagsInput && tagSuggestions) {
+	tagsInput.addEventListener("input", function () {
+		var value = tagsInput.value;
+		var cut = value.lastIndexOf(",") + 1;
+		var before = value.slice(0, cut);
+		var prefix = value.slice(cut).trim();
+
+		if (prefix === "") {
+			tagSuggestions.replaceChildren();
+			return;
+		}
+
+		fetch("/tags/suggest?q=" + encodeURIComponent(prefix))
+			.then(function (response) { return response.json(); })
+			.then(function (tags) {
+				var options = tags.map(function (tag) {
+					var option = document.createElement("option");
+					option.value = before + (before === "" ? "" : " ") + tag;
+					return option;
+				});
+				tagSuggestions.replaceChildren.apply(tagSuggestions, options);
+			});
+	});
+}